@@ -0,0 +1,154 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"peersdb/app"
+	"peersdb/config"
+	"strings"
+)
+
+// the scope each command needs, commands which are not listed need admin
+var commandScopes = map[string]string{
+	app.GET.Cmd:         config.ScopeRead,
+	app.QUERY.Cmd:       config.ScopeRead,
+	app.QUERYALL.Cmd:    config.ScopeRead,
+	app.ANNOTATIONS.Cmd: config.ScopeRead,
+	app.PEERS.Cmd:       config.ScopeRead,
+	app.PEERSLIST.Cmd:   config.ScopeRead,
+	app.BLOCKLIST.Cmd:   config.ScopeRead,
+	app.BANDWIDTH.Cmd:   config.ScopeRead,
+	app.WRITERS.Cmd:     config.ScopeRead,
+	app.STATUS.Cmd:      config.ScopeRead,
+	app.BENCHMARK.Cmd:   config.ScopeRead,
+	app.MODERATION.Cmd:  config.ScopeRead,
+
+	app.POST.Cmd:     config.ScopeWrite,
+	app.POSTENC.Cmd:  config.ScopeWrite,
+	app.RETRACT.Cmd:  config.ScopeWrite,
+	app.ANNOTATE.Cmd: config.ScopeWrite,
+	app.CONNECT.Cmd:  config.ScopeWrite,
+}
+
+func commandScope(cmd string) string {
+	scope, ok := commandScopes[cmd]
+	if !ok {
+		return config.ScopeAdmin
+	}
+	return scope
+}
+
+// extracts the token from the "Authorization: Bearer <token>" or the
+// "X-API-Key" header
+func requestToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// returns the configured key the request carries, nil if there is none
+func matchKey(r *http.Request, conf *config.Config) *config.APIKey {
+	token := requestToken(r)
+	for i, k := range conf.APIKeys {
+		if k.Token != "" && subtle.ConstantTimeCompare([]byte(k.Token), []byte(token)) == 1 {
+			return &conf.APIKeys[i]
+		}
+	}
+	return nil
+}
+
+// checks that the request carries a configured key and otherwise responds
+// with 401. If no keys are configured, only requests from this machine are let
+// through and the returned key is nil. Browsers on this machine send an origin,
+// web pages never get keyless access. Refused requests are audited.
+func authenticate(w http.ResponseWriter, r *http.Request, peersdb *app.PeersDB,
+	logChan chan app.Log) (*config.APIKey, bool) {
+
+	conf := peersdb.Config
+	if len(conf.APIKeys) == 0 {
+		if isLoopback(r) && r.Header.Get("Origin") == "" {
+			return nil, true
+		}
+		app.AuditDenied(peersdb, remoteHost(r), r.RemoteAddr, r.URL.Path, "no api keys configured", logChan)
+		http.Error(w, "no api keys configured, only local requests are allowed", http.StatusForbidden)
+		return nil, false
+	}
+
+	k := matchKey(r, conf)
+	if k == nil {
+		app.AuditDenied(peersdb, remoteHost(r), r.RemoteAddr, r.URL.Path, "unauthorized", logChan)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="peersdb"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	return k, true
+}
+
+// checks that the key has the scope the method needs and otherwise responds
+// with 403. A nil key is a local request while no keys are configured.
+func checkScope(w http.ResponseWriter, r *http.Request, peersdb *app.PeersDB, k *config.APIKey,
+	scope string, method string, logChan chan app.Log) bool {
+
+	if k != nil && !k.HasScope(scope) {
+		app.AuditDenied(peersdb, remoteHost(r), callerName(r, peersdb.Config), method, "missing scope "+scope, logChan)
+		http.Error(w, "missing scope "+scope, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// checks that the request carries a key with the given scope and otherwise
+// responds with 401 or 403
+func authorize(w http.ResponseWriter, r *http.Request, peersdb *app.PeersDB, scope string,
+	logChan chan app.Log) bool {
+
+	k, ok := authenticate(w, r, peersdb, logChan)
+	return ok && checkScope(w, r, peersdb, k, scope, r.URL.Path, logChan)
+}
+
+// whether the request comes from this machine
+func isLoopback(r *http.Request) bool {
+	ip := net.ParseIP(remoteHost(r))
+	return ip != nil && ip.IsLoopback()
+}
+
+// the remote address without the port, refused requests are limited by it
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// names the caller for the audit log, the key name if there is one and the
+// remote address otherwise
+func callerName(r *http.Request, conf *config.Config) string {
+	k := matchKey(r, conf)
+	if k != nil {
+		return "key " + k.Name + " (" + r.RemoteAddr + ")"
+	}
+	return r.RemoteAddr
+}
+
+// middleware which only lets requests with the given scope through
+func requireScope(peersdb *app.PeersDB, scope string, next http.Handler,
+	logChan chan app.Log) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, peersdb, scope, logChan) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adds our token for other nodes to a request, if there is one
+func setPeerAuth(req *http.Request, conf *config.Config) {
+	if conf.PeerAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+conf.PeerAPIKey)
+	}
+}
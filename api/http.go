@@ -11,6 +11,8 @@ import (
 	"peersdb/app"
 	"peersdb/config"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/multiformats/go-multiaddr"
 )
@@ -26,7 +28,6 @@ func benchmarksHandler(peersdb *app.PeersDB) http.HandlerFunc {
 			return
 		}
 
-		client := &http.Client{}
 		var benchmarks []app.Benchmark
 		for _, c := range cinfo {
 			ma := c.Address()
@@ -37,7 +38,7 @@ func benchmarksHandler(peersdb *app.PeersDB) http.HandlerFunc {
 				continue
 			}
 
-			bm, err := getBenchmark(client, ip)
+			bm, err := getBenchmark(peersdb.APIClient, ip, peersdb.Config)
 			if err != nil {
 				// TODO : log the error ?
 				fmt.Print(err)
@@ -61,7 +62,52 @@ func benchmarksHandler(peersdb *app.PeersDB) http.HandlerFunc {
 	}
 }
 
-func getBenchmark(client *http.Client, peerIP string) (app.Benchmark, error) {
+// returns the latest audit log entries, the number is given by the limit
+// query parameter
+func auditHandler(peersdb *app.PeersDB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if l := r.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n <= 0 {
+				http.Error(w, "invalid limit "+l, http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		entries, err := peersdb.Audit.Latest(limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jsonData, err := json.Marshal(entries)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
+	}
+}
+
+// returns the directory of peersdb nodes which recently sent a heartbeat
+func peersHandler(peersdb *app.PeersDB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonData, err := json.Marshal(peersdb.Directory.List())
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
+	}
+}
+
+func getBenchmark(client *http.Client, peerIP string, conf *config.Config) (app.Benchmark, error) {
 	var bm app.Benchmark
 
 	bmReq := app.Request{Method: app.BENCHMARK, Args: []string{}}
@@ -71,11 +117,12 @@ func getBenchmark(client *http.Client, peerIP string) (app.Benchmark, error) {
 	}
 
 	// send get benchmark request
-	cmdPath := "http://" + peerIP + ":8080/peersdb/command"
+	cmdPath := app.APIScheme() + "://" + peerIP + ":8080/peersdb/command"
 	req, err := http.NewRequest("POST", cmdPath, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return bm, err
 	}
+	setPeerAuth(req, conf)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -126,8 +173,8 @@ func extractIPFromMultiaddr(maddr multiaddr.Multiaddr) (string, error) {
 // 	return ip, nil
 // }
 
-func commandHandler(reqChan chan<- app.Request,
-	resChan <-chan interface{}) http.HandlerFunc {
+func commandHandler(peersdb *app.PeersDB, reqChan chan<- app.Request,
+	resChan <-chan interface{}, logChan chan app.Log) http.HandlerFunc {
 
 	type HTTPRequest struct {
 		Method app.Method `json:"method"`
@@ -142,6 +189,12 @@ func commandHandler(reqChan chan<- app.Request,
 			return
 		}
 
+		// the body is only read for authenticated callers
+		k, ok := authenticate(w, r, peersdb, logChan)
+		if !ok {
+			return
+		}
+
 		// parse the request body
 		var req HTTPRequest
 		err := json.NewDecoder(r.Body).Decode(&req)
@@ -150,23 +203,40 @@ func commandHandler(reqChan chan<- app.Request,
 			return
 		}
 
+		// the argument count of the client is not trusted
+		method, ok := app.MethodByCmd(req.Method.Cmd)
+		if !ok {
+			http.Error(w, "unknown command "+req.Method.Cmd, http.StatusBadRequest)
+			return
+		}
+
+		// the needed scope depends on the command
+		if !checkScope(w, r, peersdb, k, commandScope(method.Cmd), method.Cmd, logChan) {
+			return
+		}
+
 		// post request expects a file instead of the path
 		serviceReq := app.Request{
-			Method: req.Method,
+			Method: method,
 			Args:   req.Args,
+			Caller: callerName(r, peersdb.Config),
 		}
-		if serviceReq.Method == app.POST {
+		if method == app.POST || method == app.POSTENC {
 			decoded, err := base64.StdEncoding.DecodeString(req.File)
 			if err != nil {
-				// TODO : use log
-				fmt.Println("Error decoding Base64:", err)
+				http.Error(w, "invalid file : "+err.Error(), http.StatusBadRequest)
 				return
 			}
 			serviceReq.Args = append(serviceReq.Args, string(decoded))
 		}
 
+		if len(serviceReq.Args) != method.ArgCnt {
+			http.Error(w, fmt.Sprintf("%s needs %d args, got %d", method.Cmd, method.ArgCnt,
+				len(serviceReq.Args)), http.StatusBadRequest)
+			return
+		}
+
 		// send request
-		// TODO : we need to do an argument count check here aswell
 		reqChan <- serviceReq
 
 		// await response
@@ -190,15 +260,29 @@ func ServeHTTP(peersdb *app.PeersDB, reqChan chan app.Request,
 
 	server := http.NewServeMux()
 
-	// middleware to handle CORS headers and preflight requests
+	// middleware to handle CORS headers and preflight requests. Browsers send
+	// the origin of the page, only pages of -cors-origins may call the api.
+	allowedOrigins := make(map[string]bool)
+	for _, o := range strings.Split(*config.FlagCORSOrigins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			allowedOrigins[o] = true
+		}
+	}
 	mw := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ip := r.RemoteAddr
 			logChan <- app.Log{app.Info, "Received HTTP request from " + ip}
 
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "POST")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			if origin := r.Header.Get("Origin"); origin != "" {
+				if !allowedOrigins[origin] {
+					http.Error(w, "origin "+origin+" is not allowed", http.StatusForbidden)
+					return
+				}
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "POST")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+				w.Header().Add("Vary", "Origin")
+			}
 
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
@@ -210,15 +294,47 @@ func ServeHTTP(peersdb *app.PeersDB, reqChan chan app.Request,
 	}
 
 	// register command handler which allows to run commands similar to the shell
-	server.Handle("/peersdb/command", mw(commandHandler(reqChan, resChan)))
+	server.Handle("/peersdb/command", mw(commandHandler(peersdb, reqChan, resChan, logChan)))
+
+	// register the peer directory
+	server.Handle("/peersdb/peers",
+		mw(requireScope(peersdb, config.ScopeRead, peersHandler(peersdb), logChan)))
+
+	// register the audit log
+	server.Handle("/peersdb/audit",
+		mw(requireScope(peersdb, config.ScopeAdmin, auditHandler(peersdb), logChan)))
 
 	// register benchmarks handler which is specific for this API because it's
 	// used to gather all peers data
 	if *config.FlagBenchmark {
-		server.Handle("/peersdb/benchmarks", mw(benchmarksHandler(peersdb)))
+		server.Handle("/peersdb/benchmarks",
+			mw(requireScope(peersdb, config.ScopeRead, benchmarksHandler(peersdb), logChan)))
+	}
+
+	if len(peersdb.Config.APIKeys) == 0 {
+		logChan <- app.Log{app.Info, "No api keys configured, the HTTP API only accepts requests from this machine"}
 	}
 
 	// start the HTTP server
-	logChan <- app.Log{app.Info, "Starting HTTP Server"}
-	http.ListenAndServe(":"+*config.FlagHTTPPort, server)
+	if !*config.FlagTLS {
+		logChan <- app.Log{app.Info, "Starting HTTP Server"}
+		http.ListenAndServe(":"+*config.FlagHTTPPort, server)
+		return
+	}
+
+	tlsConf, err := app.ServerTLSConfig()
+	if err != nil {
+		logChan <- app.Log{app.NonRecoverableErr, err}
+		return
+	}
+	httpsServer := &http.Server{
+		Addr:      ":" + *config.FlagHTTPPort,
+		Handler:   server,
+		TLSConfig: tlsConf,
+	}
+	logChan <- app.Log{app.Info, "Starting HTTPS Server"}
+	err = httpsServer.ListenAndServeTLS("", "")
+	if err != nil {
+		logChan <- app.Log{app.NonRecoverableErr, err}
+	}
 }
@@ -27,7 +27,7 @@ func processReq(cmdList []string, method app.Method,
 	}
 
 	// send request
-	reqChan <- app.Request{Method: method, Args: cmdList[1:]}
+	reqChan <- app.Request{Method: method, Args: cmdList[1:], Caller: "shell"}
 
 	// await response and log it
 	res := <-resChan
@@ -35,6 +35,34 @@ func processReq(cmdList []string, method app.Method,
 	logChan <- app.Log{Type: app.Print, Data: "\n"}
 }
 
+// forwards a command with sub commands like "peers add <addr>" as the method
+// named "<command>-<sub command>"
+func processSubReq(cmdList []string, methods []app.Method,
+	reqChan chan app.Request,
+	resChan chan interface{},
+	logChan chan app.Log) {
+
+	if len(cmdList) < 2 {
+		logChan <- app.Log{
+			Type: app.RecoverableErr,
+			Data: errors.New("double check the given args")}
+		return
+	}
+
+	cmd := cmdList[0] + "-" + cmdList[1]
+	for _, m := range methods {
+		if m.Cmd == cmd {
+			subCmdList := append([]string{cmd}, cmdList[2:]...)
+			processReq(subCmdList, m, reqChan, resChan, logChan)
+			return
+		}
+	}
+
+	logChan <- app.Log{
+		Type: app.RecoverableErr,
+		Data: errors.New("sub command not supported")}
+}
+
 // start listening for commands, implements the api for the user
 func Shell(reqChan chan app.Request,
 	resChan chan interface{},
@@ -61,8 +89,12 @@ func Shell(reqChan chan app.Request,
 		case app.GET.Cmd:
 			processReq(cmdList, app.GET, reqChan, resChan, logChan)
 
-		case app.POST.Cmd:
-			if len(cmdList) != app.POST.ArgCnt+1 {
+		case app.POST.Cmd, app.POSTENC.Cmd:
+			method := app.POST
+			if cmdList[0] == app.POSTENC.Cmd {
+				method = app.POSTENC
+			}
+			if len(cmdList) != method.ArgCnt+1 {
 				logChan <- app.Log{
 					Type: app.RecoverableErr,
 					Data: errors.New("double check the given args")}
@@ -76,9 +108,9 @@ func Shell(reqChan chan app.Request,
 				logChan <- app.Log{Type: app.RecoverableErr, Data: err}
 				break
 			}
-			cmdList = []string{app.POST.Cmd, string(fileBytes)}
+			cmdList = []string{method.Cmd, string(fileBytes)}
 
-			processReq(cmdList, app.POST, reqChan, resChan, logChan)
+			processReq(cmdList, method, reqChan, resChan, logChan)
 
 		case app.CONNECT.Cmd:
 			processReq(cmdList, app.CONNECT, reqChan, resChan, logChan)
@@ -86,6 +118,82 @@ func Shell(reqChan chan app.Request,
 		case app.QUERY.Cmd:
 			processReq(cmdList, app.QUERY, reqChan, resChan, logChan)
 
+		case app.QUERYALL.Cmd:
+			processReq(cmdList, app.QUERYALL, reqChan, resChan, logChan)
+
+		case app.RETRACT.Cmd:
+			processReq(cmdList, app.RETRACT, reqChan, resChan, logChan)
+
+		case app.EXPORT.Cmd:
+			processReq(cmdList, app.EXPORT, reqChan, resChan, logChan)
+
+		case app.IMPORT.Cmd:
+			processReq(cmdList, app.IMPORT, reqChan, resChan, logChan)
+
+		case app.GC.Cmd:
+			processReq(cmdList, app.GC, reqChan, resChan, logChan)
+
+		case app.REPO.Cmd:
+			processReq(cmdList, app.REPO, reqChan, resChan, logChan)
+
+		case app.ANNOTATE.Cmd:
+			processReq(cmdList, app.ANNOTATE, reqChan, resChan, logChan)
+
+		case app.ANNOTATIONS.Cmd:
+			processReq(cmdList, app.ANNOTATIONS, reqChan, resChan, logChan)
+
+		case "peers":
+			// without sub command the peer directory is shown
+			if len(cmdList) == 1 {
+				processReq(cmdList, app.PEERS, reqChan, resChan, logChan)
+				break
+			}
+			peersMethods := []app.Method{app.PEERSADD, app.PEERSREMOVE, app.PEERSLIST}
+			processSubReq(cmdList, peersMethods, reqChan, resChan, logChan)
+
+		case app.DISCONNECT.Cmd:
+			processReq(cmdList, app.DISCONNECT, reqChan, resChan, logChan)
+
+		case app.BLOCK.Cmd:
+			processReq(cmdList, app.BLOCK, reqChan, resChan, logChan)
+
+		case app.UNBLOCK.Cmd:
+			processReq(cmdList, app.UNBLOCK, reqChan, resChan, logChan)
+
+		case app.BLOCKLIST.Cmd:
+			processReq(cmdList, app.BLOCKLIST, reqChan, resChan, logChan)
+
+		case app.BANDWIDTH.Cmd:
+			processReq(cmdList, app.BANDWIDTH, reqChan, resChan, logChan)
+
+		case app.GRANT.Cmd:
+			processReq(cmdList, app.GRANT, reqChan, resChan, logChan)
+
+		case app.REVOKE.Cmd:
+			processReq(cmdList, app.REVOKE, reqChan, resChan, logChan)
+
+		case app.WRITERS.Cmd:
+			processReq(cmdList, app.WRITERS, reqChan, resChan, logChan)
+
+		case app.INVITE.Cmd:
+			processReq(cmdList, app.INVITE, reqChan, resChan, logChan)
+
+		case app.JOIN.Cmd:
+			processReq(cmdList, app.JOIN, reqChan, resChan, logChan)
+
+		case app.STATUS.Cmd:
+			processReq(cmdList, app.STATUS, reqChan, resChan, logChan)
+
+		case app.MODERATION.Cmd:
+			processReq(cmdList, app.MODERATION, reqChan, resChan, logChan)
+
+		case app.AUDIT.Cmd:
+			processReq(cmdList, app.AUDIT, reqChan, resChan, logChan)
+
+		case "identity":
+			identityMethods := []app.Method{app.IDEXPORT, app.IDIMPORT, app.IDROTATE}
+			processSubReq(cmdList, identityMethods, reqChan, resChan, logChan)
+
 		case app.BENCHMARK.Cmd:
 			processReq(cmdList, app.BENCHMARK, reqChan, resChan, logChan)
 
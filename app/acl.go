@@ -0,0 +1,120 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"peersdb/config"
+	"strings"
+
+	"berty.tech/go-orbit-db/accesscontroller"
+	"golang.org/x/net/context"
+)
+
+// capabilities of the contributions store's access controller
+const (
+	writeCapability = "write"
+	adminCapability = "admin"
+)
+
+// the access controller a root node creates the contributions store with. It's
+// an orbitdb access controller, so admins can grant and revoke writers later
+// on. The creating node is always admin and writer.
+func contributionsAccess(peersDB *PeersDB) *accesscontroller.CreateAccessControllerOptions {
+	ownID := (*peersDB.Orbit).Identity().ID
+
+	writers := []string{ownID}
+	for _, w := range strings.Split(*config.FlagWriters, ",") {
+		w = strings.TrimSpace(w)
+		if w != "" && w != ownID {
+			writers = append(writers, w)
+		}
+	}
+
+	return &accesscontroller.CreateAccessControllerOptions{
+		Type: "orbitdb",
+		Access: map[string][]string{
+			writeCapability: writers,
+			adminCapability: {ownID},
+		},
+	}
+}
+
+// checks that the capability is one of the access controller's
+func checkCapability(capability string) error {
+	if capability != writeCapability && capability != adminCapability {
+		return fmt.Errorf("unknown capability %s, try %s or %s", capability,
+			writeCapability, adminCapability)
+	}
+	return nil
+}
+
+// executes grant command, only admins may grant capabilities
+func grant(peersDB *PeersDB, capability string, identity string, logChan chan Log) interface{} {
+	db := peersDB.Contributions
+	if db == nil {
+		err := errors.New("you need a datastore first, try connecting to a peer")
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	err := checkCapability(capability)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	err = (*db).AccessController().Grant(context.Background(), capability, identity)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return "Granted " + capability + " to " + identity
+}
+
+// executes revoke command, only admins may revoke capabilities
+func revoke(peersDB *PeersDB, capability string, identity string, logChan chan Log) interface{} {
+	db := peersDB.Contributions
+	if db == nil {
+		err := errors.New("you need a datastore first, try connecting to a peer")
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	err := checkCapability(capability)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	err = (*db).AccessController().Revoke(context.Background(), capability, identity)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return "Revoked " + capability + " from " + identity
+}
+
+// executes writers command, returns the identities per capability
+func writers(peersDB *PeersDB, logChan chan Log) interface{} {
+	db := peersDB.Contributions
+	if db == nil {
+		err := errors.New("you need a datastore first, try connecting to a peer")
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	ac := (*db).AccessController()
+	res := map[string][]string{}
+	for _, capability := range []string{writeCapability, adminCapability} {
+		ids, err := ac.GetAuthorizedByRole(capability)
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+			return err
+		}
+		res[capability] = ids
+	}
+
+	return res
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	orbitdb "berty.tech/go-orbit-db"
+	"berty.tech/go-orbit-db/accesscontroller"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"golang.org/x/net/context"
+)
+
+// mutable metadata on a contribution. Every identity keeps one annotation per
+// contribution, stored under "<contribution cid>/<orbitdb identity>" in the
+// replicated annotations keyvalue store.
+type Annotation struct {
+	Rating      int       `json:"rating,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	Recommended bool      `json:"recommended"` // recommended for training
+	Annotator   string    `json:"annotator"`   // orbitdb identity which signed the annotation
+	UpdateTS    time.Time `json:"updateTS"`    // timestamp of the last change
+}
+
+// opens the annotations store belonging to the contributions store. Its name is
+// derived from the contributions address, so all peers of a contributions
+// store end up with the same annotations store without exchanging its address.
+func openAnnotations(ctx context.Context, peersDB *PeersDB) error {
+	if peersDB.Contributions == nil {
+		return errors.New("you need a datastore first, try connecting to a peer")
+	}
+	name := "annotations-" + (*peersDB.Contributions).Address().GetRoot().String()
+
+	// give write access to all
+	ac := &accesscontroller.CreateAccessControllerOptions{
+		Access: map[string][]string{
+			"write": {
+				"*",
+			},
+		},
+	}
+
+	storeType := "keyvalue"
+	create := true
+	annotationsCache := filepath.Join(orbitCacheDir(), "annotations")
+	dbopts := orbitdb.CreateDBOptions{
+		Create:           &create,
+		StoreType:        &storeType,
+		AccessController: ac,
+		Directory:        &annotationsCache,
+		EventBus:         eventbus.NewBus(),
+	}
+
+	store, err := (*peersDB.Orbit).KeyValue(ctx, name, &dbopts)
+	if err != nil {
+		return err
+	}
+	store.Load(ctx, -1)
+	peersDB.Annotations = &store
+
+	return nil
+}
+
+// executes annotate command, sets one field of this node's annotation for the
+// given contribution
+func annotate(peersDB *PeersDB, ipfsPath string, field string, value string,
+	logChan chan Log) interface{} {
+
+	db := peersDB.Annotations
+	if db == nil {
+		err := errors.New("you need a datastore first, try connecting to a peer")
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	cid, err := extractCIDFromIPFSPath(ipfsPath)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	ownID := (*peersDB.Orbit).Identity().ID
+	key := cid + "/" + ownID
+
+	peersDB.AnnotationsMtx.Lock()
+	defer peersDB.AnnotationsMtx.Unlock()
+
+	// start from our current annotation, if any
+	ctx := context.Background()
+	annotation := signedAnnotations(*db, cid)[ownID]
+
+	switch field {
+	case "rating":
+		annotation.Rating, err = strconv.Atoi(value)
+	case "note":
+		annotation.Note = value
+	case "recommended":
+		annotation.Recommended, err = strconv.ParseBool(value)
+	default:
+		err = fmt.Errorf("unknown annotation field %s, try rating, note or recommended", field)
+	}
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	annotation.Annotator = ownID
+	annotation.UpdateTS = time.Now()
+
+	data, err := json.Marshal(annotation)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	_, err = (*db).Put(ctx, key, data)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return "Annotated " + ipfsPath
+}
+
+// executes annotations command
+func annotations(peersDB *PeersDB, ipfsPath string, logChan chan Log) interface{} {
+	res, err := getAnnotations(peersDB, ipfsPath)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	return res
+}
+
+// gathers the annotations of all peers for the given contribution
+func getAnnotations(peersDB *PeersDB, ipfsPath string) ([]Annotation, error) {
+	db := peersDB.Annotations
+	if db == nil {
+		return nil, errors.New("you need a datastore first, try connecting to a peer")
+	}
+
+	cid, err := extractCIDFromIPFSPath(ipfsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	peersDB.AnnotationsMtx.RLock()
+	defer peersDB.AnnotationsMtx.RUnlock()
+
+	var res []Annotation
+	for _, annotation := range signedAnnotations(*db, cid) {
+		res = append(res, annotation)
+	}
+
+	return res, nil
+}
+
+// replays the annotations store's log and returns the annotations on the
+// given contribution by annotator. The store is writable by all, so only
+// writes under the signing identity's own key count and the annotator is
+// taken from the signature, not from the value.
+func signedAnnotations(db orbitdb.KeyValueStore, cid string) map[string]Annotation {
+	res := make(map[string]Annotation)
+	for _, entry := range db.OpLog().Values().Slice() {
+		var op opDoc
+		if json.Unmarshal(entry.GetPayload(), &op) != nil {
+			continue
+		}
+
+		signer := entry.GetIdentity().ID
+		if op.Key != cid+"/"+signer {
+			continue
+		}
+
+		switch op.Op {
+		case "PUT":
+			var annotation Annotation
+			if json.Unmarshal(op.Value, &annotation) != nil {
+				continue
+			}
+			annotation.Annotator = signer
+			res[signer] = annotation
+		case "DEL":
+			delete(res, signer)
+		}
+	}
+
+	return res
+}
@@ -1,36 +1,77 @@
 package app
 
 import (
+	"net/http"
 	"peersdb/config"
+	"peersdb/ipfs"
 	"sync"
 
 	orbitdb "berty.tech/go-orbit-db"
 	"berty.tech/go-orbit-db/iface"
 	"github.com/ipfs/kubo/core"
+	"github.com/libp2p/go-libp2p/core/network"
 )
 
-// TODO : should have a peers store to permanently add/remove known peers which
-// we will try to connect to on startup
-//
 // represents the application across go routines
 type PeersDB struct {
 	// data storage
 	Node          *core.IpfsNode         // TODO : only because of node.PeerHost.EventBus
 	Contributions *orbitdb.EventLogStore // the log which holds all contributions
 	Validations   *orbitdb.DocumentStore // the store which holds all validations
+	Annotations   *orbitdb.KeyValueStore // the store which holds mutable metadata on contributions
 	Orbit         *iface.OrbitDB
 
-	// mutex to control access to the eventlog db across go routines
+	// the latest trusted snapshot of the contributions eventlog, may be nil
+	Snapshot *Snapshot
+
+	// mutex to control access to the eventlog db and its snapshot across go
+	// routines
 	ContributionsMtx sync.RWMutex
 	ValidationsMtx   sync.RWMutex
+	AnnotationsMtx   sync.RWMutex
+
+	// mutex to make sure only one contributions store is replicated
+	ReplicateMtx sync.Mutex
 
 	// persisted peersdb config
 	Config *config.Config
 
+	// persisted peers we try to stay connected to
+	KnownPeers *KnownPeers
+
+	// traffic per peer and protocol, enforces the bandwidth limits
+	Bandwidth *ipfs.BandwidthMeter
+
+	// persisted peer ids and identities we refuse to talk to
+	Blocklist *Blocklist
+
+	// persisted write invites which were used already
+	RedeemedInvites *RedeemedInvites
+
+	// client for the http apis of other nodes
+	APIClient *http.Client
+
+	// append-only log of commands, store writes and pin changes, nil if
+	// disabled
+	Audit *AuditLog
+
+	// contribution limits per identity and the offenders
+	Moderation *Moderation
+
+	// peersdb nodes which recently sent a heartbeat
+	Directory *PeerDirectory
+
+	// reachability of this node as detected by AutoNAT
+	Reachability network.Reachability
+	StatusMtx    sync.RWMutex
+
 	// benchmarks
 	Benchmark *Benchmark
 }
 
+// version of peersdb announced to other peers
+const Version = "0.1.0"
+
 // TODO : check out orbitdb logger (apparently safe for concurrent use and lightweight
 type LogType uint8
 
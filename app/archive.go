@@ -0,0 +1,343 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"peersdb/ipfs"
+	"strings"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	mh "github.com/multiformats/go-multihash"
+	"golang.org/x/net/context"
+)
+
+// the root block of an exported archive, it lists the contained contributions
+// so they can be added to the eventlog on import
+type archiveManifest struct {
+	StoreAddr     string                 `json:"storeAddr"` // the store the contributions were exported from
+	Contributions []archivedContribution `json:"contributions"`
+}
+
+type archivedContribution struct {
+	Entry        string       `json:"entry"`            // cid of the original eventlog entry
+	Signer       string       `json:"signer,omitempty"` // orbitdb identity which signed the entry
+	Contribution Contribution `json:"contribution"`
+}
+
+// the manifest is stored as raw json block
+var manifestPrefix = cid.Prefix{
+	Version:  1,
+	Codec:    cid.Raw,
+	MhType:   mh.SHA2_256,
+	MhLength: -1,
+}
+
+// executes export command, writes the contributions matching the filter
+// together with their data into a CARv1 file.
+// The filter is either "*" or a comma separated list of ipfs paths.
+func export(peersDB *PeersDB, dest string, filter string, logChan chan Log) interface{} {
+	ctx := context.Background()
+	coreAPI := (*peersDB.Orbit).IPFS()
+
+	// contributions store may be nil for non-root nodes
+	db := peersDB.Contributions
+	if db == nil {
+		err := errors.New("you need a datastore first, try connecting to a peer")
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	wanted := make(map[string]bool)
+	if filter != "*" {
+		for _, p := range strings.Split(filter, ",") {
+			wanted[p] = true
+		}
+	}
+
+	state, err := materialize(ctx, peersDB)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	manifest := archiveManifest{StoreAddr: (*db).Address().String()}
+	for _, r := range state.Records {
+		// retracted and blocked contributions are never exported
+		if r.Retracted || r.Blocked {
+			continue
+		}
+
+		if len(wanted) > 0 && !wanted[r.Contribution.Path] {
+			continue
+		}
+
+		manifest.Contributions = append(manifest.Contributions,
+			archivedContribution{r.Entry, r.Signer, r.Contribution})
+	}
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	manifestCID, err := manifestPrefix.Sum(manifestJSON)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	manifestBlk, err := blocks.NewBlockWithCid(manifestJSON, manifestCID)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	dest, err = expandHome(dest)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	file, err := os.Create(dest)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	defer file.Close()
+
+	car, err := ipfs.NewCARWriter(file, []cid.Cid{manifestCID})
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	if err := car.Put(manifestBlk); err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	// write the unixfs dags of all contributions, blocks shared between
+	// contributions are only written once
+	visited := make(map[cid.Cid]bool)
+	for _, c := range manifest.Contributions {
+		resolved, err := coreAPI.ResolvePath(ctx, path.New(c.Contribution.Path))
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+			return err
+		}
+
+		err = walkDAG(ctx, peersDB, resolved.Cid(), visited, func(n ipld.Node) error {
+			return car.Put(n)
+		})
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+			return err
+		}
+	}
+
+	return fmt.Sprintf("exported %d contributions to %s",
+		len(manifest.Contributions), dest)
+}
+
+// calls fn once for each node of the dag below root, nodes in visited are
+// skipped
+func walkDAG(ctx context.Context, peersDB *PeersDB, root cid.Cid,
+	visited map[cid.Cid]bool, fn func(ipld.Node) error) error {
+
+	if visited[root] {
+		return nil
+	}
+	visited[root] = true
+
+	n, err := (*peersDB.Orbit).IPFS().Dag().Get(ctx, root)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(n); err != nil {
+		return err
+	}
+
+	for _, l := range n.Links() {
+		if err := walkDAG(ctx, peersDB, l.Cid, visited, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// executes import command, stores all blocks of the archive, pins the
+// contributions and adds those missing from the eventlog
+func importArchive(peersDB *PeersDB, src string, logChan chan Log) interface{} {
+	ctx := context.Background()
+	coreAPI := (*peersDB.Orbit).IPFS()
+
+	// contributions store may be nil for non-root nodes
+	db := peersDB.Contributions
+	if db == nil {
+		err := errors.New("you need a datastore first, try connecting to a peer")
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	src, err := expandHome(src)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	file, err := os.Open(src)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	defer file.Close()
+
+	// store all blocks locally, no network access is needed for any of this
+	bs := peersDB.Node.Blockstore
+	roots, err := ipfs.ReadCAR(file, func(blk blocks.Block) error {
+		return bs.Put(ctx, blk)
+	})
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	if len(roots) != 1 || roots[0].Prefix() != manifestPrefix {
+		err := errors.New("archive does not contain a peersdb manifest")
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	// the manifest block itself is not pinned and will be collected eventually
+	manifestBlk, err := bs.Get(ctx, roots[0])
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	var manifest archiveManifest
+	err = json.Unmarshal(manifestBlk.RawData(), &manifest)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	// find out which contributions we know already
+	state, err := materialize(ctx, peersDB)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	known := make(map[string]bool, len(state.Records))
+	for _, r := range state.Records {
+		known[r.Entry] = true
+		known[r.Contribution.Path] = true
+	}
+
+	// contributions made before an identity rotation name a former peer id
+	retired, err := ipfs.RetiredKeys()
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	added, skipped := 0, 0
+	for _, c := range manifest.Contributions {
+		err := coreAPI.Pin().Add(ctx, path.New(c.Contribution.Path),
+			options.Pin.Recursive(true))
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+			continue
+		}
+		auditPinChange(peersDB, auditPin, c.Contribution.Path, logChan)
+
+		if known[c.Entry] || known[c.Contribution.Path] {
+			continue
+		}
+
+		// the contributor's signature binds the identity of the original
+		// entry, while the new entry is signed by our identity. Only our own
+		// contributions can be signed again, the others would never verify.
+		key, ok := ownContributorKey(peersDB, &c, retired)
+		if !ok {
+			logChan <- Log{Info, "Skipped " + c.Contribution.Path + " of " +
+				c.Contribution.Contributor + ", it can't be signed for our identity"}
+			skipped++
+			continue
+		}
+		err = signContributionWith(peersDB, &c.Contribution, key)
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+			continue
+		}
+
+		contributionJSON, err := json.Marshal(c.Contribution)
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+			continue
+		}
+
+		peersDB.ContributionsMtx.Lock()
+		_, err = (*db).Add(ctx, contributionJSON)
+		peersDB.ContributionsMtx.Unlock()
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+			continue
+		}
+		added++
+	}
+
+	res := fmt.Sprintf("imported %d contributions, %d of them were new",
+		len(manifest.Contributions), added)
+	if skipped > 0 {
+		res += fmt.Sprintf(", %d of other contributors were not added to the eventlog "+
+			"since they can't be signed for this node, their data is pinned", skipped)
+	}
+	return res
+}
+
+// returns the key an archived contribution of this node is signed with again.
+// Our orbitdb identity stays the same when the peer id changes, so it tells
+// our contributions apart. Archives without signer fall back to the peer ids
+// this node had.
+func ownContributorKey(peersDB *PeersDB, c *archivedContribution,
+	retired map[string]crypto.PrivKey) (crypto.PrivKey, bool) {
+
+	contributor := c.Contribution.Contributor
+	if c.Signer != "" && c.Signer != (*peersDB.Orbit).Identity().ID {
+		return nil, false
+	}
+
+	if contributor == peersDB.Config.PeerID {
+		return peersDB.Node.PrivateKey, true
+	}
+	if key, ok := retired[contributor]; ok {
+		return key, true
+	}
+
+	// our own contribution, but the key of the peer id it names is gone
+	if c.Signer != "" {
+		c.Contribution.Contributor = peersDB.Config.PeerID
+		return peersDB.Node.PrivateKey, true
+	}
+	return nil, false
+}
+
+// expands the tilde (~) notation to the user's home directory
+func expandHome(p string) (string, error) {
+	if !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(usr.HomeDir, p[2:]), nil
+}
@@ -0,0 +1,492 @@
+package app
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"peersdb/config"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"berty.tech/go-orbit-db/iface"
+	"berty.tech/go-orbit-db/stores"
+)
+
+// kinds of audit entries
+const (
+	auditCommand   = "command"
+	auditWrite     = "write"
+	auditReplicate = "replicate"
+	auditPin       = "pin"
+	auditUnpin     = "unpin"
+	auditDenied    = "denied"
+)
+
+// how long a single argument or result may be in the audit log
+const auditSummaryLen = 128
+
+// refused requests of a remote host are recorded at most once per interval,
+// the ones in between are only counted
+const deniedInterval = time.Minute
+
+// one line of the audit log
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`             // command, write, replicate, pin, unpin or denied
+	Caller string    `json:"caller,omitempty"` // shell, the api key name or the remote address
+	Method string    `json:"method,omitempty"` // the command or the store address
+	Args   []string  `json:"args,omitempty"`   // summary of the arguments or the entry hashes
+	Result string    `json:"result,omitempty"` // summary of the result
+}
+
+// append-only log of all commands, store writes and pin changes. It is
+// written as json lines and rotated once it exceeds -audit-max-size. Rotated
+// files are compressed, only the latest -audit-keep are kept.
+type AuditLog struct {
+	mtx  sync.Mutex
+	file *os.File
+	size int64
+
+	deniedMtx sync.Mutex
+	denied    map[string]*deniedWindow // by remote host
+	pruned    time.Time
+}
+
+// the refused requests of a remote host since its last recorded one
+type deniedWindow struct {
+	start      time.Time
+	suppressed int
+}
+
+// the file the audit log is written to
+func auditPath() string {
+	return *config.FlagRepo + "_audit"
+}
+
+// the rotated files, oldest first. Their names end with the rotation time, so
+// they sort chronologically.
+func rotatedAuditPaths() ([]string, error) {
+	paths, err := filepath.Glob(auditPath() + ".*.gz")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// opens the audit log for appending, nil is returned if it's disabled
+func OpenAuditLog() (*AuditLog, error) {
+	if !*config.FlagAudit {
+		return nil, nil
+	}
+
+	al := &AuditLog{denied: map[string]*deniedWindow{}}
+	err := al.open()
+	if err != nil {
+		return nil, err
+	}
+	return al, nil
+}
+
+func (al *AuditLog) open() error {
+	file, err := os.OpenFile(auditPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	al.file = file
+	al.size = info.Size()
+	return nil
+}
+
+// compresses the current file into <repo>_audit.<rotation time>.gz and starts
+// a new one. The current file is only removed once its copy is complete, the
+// oldest rotated files beyond -audit-keep are removed afterwards. Has to be
+// called with the lock held.
+func (al *AuditLog) rotate() error {
+	err := al.file.Close()
+	if err != nil {
+		return err
+	}
+
+	dest := auditPath() + "." + time.Now().UTC().Format("20060102T150405.000000000Z") + ".gz"
+	err = compressFile(auditPath(), dest)
+	if err != nil {
+		// keep writing to the current file rather than losing entries
+		os.Remove(dest)
+		openErr := al.open()
+		if openErr != nil {
+			return openErr
+		}
+		return err
+	}
+
+	err = os.Remove(auditPath())
+	if err != nil {
+		return err
+	}
+	err = al.open()
+	if err != nil {
+		return err
+	}
+	return removeOldAuditFiles()
+}
+
+// removes the oldest rotated files beyond -audit-keep, 0 keeps all of them
+func removeOldAuditFiles() error {
+	keep := *config.FlagAuditKeep
+	if keep <= 0 {
+		return nil
+	}
+
+	rotated, err := rotatedAuditPaths()
+	if err != nil {
+		return err
+	}
+	for len(rotated) > keep {
+		err = os.Remove(rotated[0])
+		if err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// writes a gzip compressed copy of src to dest
+func compressFile(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err != nil {
+		return err
+	}
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// appends an entry, a disabled audit log ignores everything
+func (al *AuditLog) Append(e AuditEntry) error {
+	if al == nil {
+		return nil
+	}
+	e.Time = time.Now()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+
+	maxSize := int64(*config.FlagAuditMaxSize) * 1024 * 1024
+	if maxSize > 0 && al.size > 0 && al.size+int64(len(line)) > maxSize {
+		err = al.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := al.file.Write(line)
+	al.size += int64(n)
+	return err
+}
+
+// returns the latest entries, oldest first, including the rotated files
+func (al *AuditLog) Latest(limit int) ([]AuditEntry, error) {
+	if al == nil {
+		return nil, fmt.Errorf("the audit log is disabled, use -audit to enable it")
+	}
+
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+
+	rotated, err := rotatedAuditPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	// newest file first
+	paths := []string{auditPath()}
+	for i := len(rotated) - 1; i >= 0; i-- {
+		paths = append(paths, rotated[i])
+	}
+
+	var entries []AuditEntry
+	for _, p := range paths {
+		if len(entries) >= limit {
+			break
+		}
+
+		fileEntries, err := readAuditFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		// older files come before the entries found so far
+		entries = append(fileEntries, entries...)
+	}
+
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+// reads all entries of an audit file, rotated files are decompressed
+func readAuditFile(p string) ([]AuditEntry, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if filepath.Ext(p) == ".gz" {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// shortens a string for the audit log
+func summarize(s string) string {
+	if len(s) <= auditSummaryLen {
+		return s
+	}
+	return fmt.Sprintf("%s... (%d bytes)", s[:auditSummaryLen], len(s))
+}
+
+// records a command and its result
+func auditRequest(peersDB *PeersDB, req Request, res interface{}, logChan chan Log) {
+	e := AuditEntry{Kind: auditCommand, Caller: req.Caller, Method: req.Method.Cmd}
+
+	// files are not logged, only their size
+	for _, a := range req.Args {
+		if req.Method == POST || req.Method == POSTENC {
+			a = fmt.Sprintf("<%d bytes>", len(a))
+		}
+		e.Args = append(e.Args, summarize(a))
+	}
+
+	switch r := res.(type) {
+	case error:
+		e.Result = "error : " + summarize(r.Error())
+	case string:
+		e.Result = summarize(r)
+	case nil:
+		e.Result = "no result"
+	default:
+		e.Result = "ok"
+	}
+
+	err := peersDB.Audit.Append(e)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+	}
+}
+
+// records a refused request unless the remote host already had one within
+// the interval, then it's only counted. The count is recorded once the
+// interval of the host is over.
+func (al *AuditLog) Denied(remote string, e AuditEntry) error {
+	if al == nil {
+		return nil
+	}
+	now := time.Now()
+	var entries []AuditEntry
+
+	al.deniedMtx.Lock()
+	if now.Sub(al.pruned) >= deniedInterval {
+		for host, w := range al.denied {
+			if now.Sub(w.start) < deniedInterval {
+				continue
+			}
+			if w.suppressed > 0 {
+				entries = append(entries, AuditEntry{
+					Kind:   auditDenied,
+					Caller: host,
+					Result: fmt.Sprintf("%d more refused requests", w.suppressed),
+				})
+			}
+			delete(al.denied, host)
+		}
+		al.pruned = now
+	}
+
+	w := al.denied[remote]
+	if w != nil && now.Sub(w.start) < deniedInterval {
+		w.suppressed++
+	} else {
+		if w != nil && w.suppressed > 0 {
+			e.Result += fmt.Sprintf(" (%d more refused requests before)", w.suppressed)
+		}
+		al.denied[remote] = &deniedWindow{start: now}
+		entries = append(entries, e)
+	}
+	al.deniedMtx.Unlock()
+
+	for _, e := range entries {
+		err := al.Append(e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// records a request the http api refused, caller and method are the same as
+// for commands. Refused requests are limited per remote host, see Denied.
+func AuditDenied(peersDB *PeersDB, remote string, caller string, method string, reason string,
+	logChan chan Log) {
+
+	err := peersDB.Audit.Denied(remote, AuditEntry{
+		Kind:   auditDenied,
+		Caller: caller,
+		Method: method,
+		Result: reason,
+	})
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+	}
+}
+
+// records a pin change
+func auditPinChange(peersDB *PeersDB, kind string, ipfsPath string, logChan chan Log) {
+	err := peersDB.Audit.Append(AuditEntry{Kind: kind, Args: []string{ipfsPath}})
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+	}
+}
+
+// records the local writes and replicated entries of a store, the store is
+// looked up until it exists
+func auditStore(peersDB *PeersDB, lookup func() iface.Store, logChan chan Log) {
+	if peersDB.Audit == nil {
+		return
+	}
+
+	store := lookup()
+	for store == nil {
+		time.Sleep(time.Second)
+		store = lookup()
+	}
+
+	sub, err := store.EventBus().Subscribe([]interface{}{
+		new(stores.EventWrite),
+		new(stores.EventReplicated),
+	})
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+	defer sub.Close()
+
+	for e := range sub.Out() {
+		var entry AuditEntry
+		switch e := e.(type) {
+		case stores.EventWrite:
+			entry = AuditEntry{
+				Kind:   auditWrite,
+				Caller: e.Entry.GetIdentity().ID,
+				Method: e.Address.String(),
+				Args:   []string{e.Entry.GetHash().String()},
+			}
+		case stores.EventReplicated:
+			entry = AuditEntry{Kind: auditReplicate, Method: e.Address.String()}
+			for _, re := range e.Entries {
+				entry.Args = append(entry.Args, re.GetHash().String())
+			}
+		default:
+			continue
+		}
+
+		err := peersDB.Audit.Append(entry)
+		if err != nil {
+			logChan <- Log{RecoverableErr, err}
+		}
+	}
+}
+
+// starts auditing all stores
+func auditStores(peersDB *PeersDB, logChan chan Log) {
+	go auditStore(peersDB, func() iface.Store {
+		if peersDB.Contributions == nil {
+			return nil
+		}
+		return *peersDB.Contributions
+	}, logChan)
+	go auditStore(peersDB, func() iface.Store {
+		if peersDB.Validations == nil {
+			return nil
+		}
+		return *peersDB.Validations
+	}, logChan)
+	go auditStore(peersDB, func() iface.Store {
+		if peersDB.Annotations == nil {
+			return nil
+		}
+		return *peersDB.Annotations
+	}, logChan)
+}
+
+// executes audit command, returns the latest entries
+func audit(peersDB *PeersDB, limit string, logChan chan Log) interface{} {
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		err := fmt.Errorf("invalid number of entries %s", limit)
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	entries, err := peersDB.Audit.Latest(n)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	return entries
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"peersdb/ipfs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// how often the traffic of gone peers is aged out
+const bandwidthPruneInterval = 10 * time.Minute
+
+// bandwidth used by a single peer
+type PeerBandwidth struct {
+	Peer      string                  `json:"peer"`
+	TotalIn   int64                   `json:"totalIn"`   // bytes received from the peer
+	TotalOut  int64                   `json:"totalOut"`  // bytes sent to the peer
+	RateIn    float64                 `json:"rateIn"`    // bytes per second
+	RateOut   float64                 `json:"rateOut"`   // bytes per second
+	Protocols map[string]ipfs.Traffic `json:"protocols"` // bytes per protocol category, see protocolCategory
+}
+
+// bandwidth of all peers and the configured limits
+type BandwidthReport struct {
+	Limit     int64           `json:"limit"`     // bytes per second and direction, 0 is unlimited
+	PeerLimit int64           `json:"peerLimit"` // bytes per second, direction and peer, 0 is unlimited
+	Peers     []PeerBandwidth `json:"peers"`
+}
+
+// groups protocol ids into the parts of peersdb they belong to
+func protocolCategory(proto string) string {
+	switch {
+	case strings.HasPrefix(proto, "/ipfs/bitswap"):
+		return "bitswap"
+	case strings.HasPrefix(proto, "/meshsub"), strings.HasPrefix(proto, "/floodsub"):
+		return "pubsub"
+	case strings.HasPrefix(proto, "/go-orbit-db"):
+		return "orbitdb"
+	case strings.HasPrefix(proto, "/ipfs/kad"), strings.HasPrefix(proto, "/ipfs/lan/kad"):
+		return "dht"
+	default:
+		return "other"
+	}
+}
+
+// executes bandwidth command
+func bandwidth(peersDB *PeersDB) BandwidthReport {
+	meter := peersDB.Bandwidth
+	limit, peerLimit := meter.Limits()
+	report := BandwidthReport{Limit: limit, PeerLimit: peerLimit, Peers: []PeerBandwidth{}}
+
+	for p, protos := range meter.Traffic() {
+		stats := meter.GetBandwidthForPeer(p)
+		pb := PeerBandwidth{
+			Peer:      p.String(),
+			TotalIn:   stats.TotalIn,
+			TotalOut:  stats.TotalOut,
+			RateIn:    stats.RateIn,
+			RateOut:   stats.RateOut,
+			Protocols: make(map[string]ipfs.Traffic),
+		}
+		for proto, t := range protos {
+			category := protocolCategory(string(proto))
+			sum := pb.Protocols[category]
+			sum.In += t.In
+			sum.Out += t.Out
+			pb.Protocols[category] = sum
+		}
+		report.Peers = append(report.Peers, pb)
+	}
+
+	// heaviest peers first
+	sort.Slice(report.Peers, func(i, j int) bool {
+		return report.Peers[i].TotalIn+report.Peers[i].TotalOut >
+			report.Peers[j].TotalIn+report.Peers[j].TotalOut
+	})
+
+	return report
+}
+
+// drops the rate limiters of disconnected peers and ages out the traffic of
+// peers which are gone
+func pruneBandwidth(peersDB *PeersDB, logChan chan Log) {
+	host := peersDB.Node.PeerHost
+	sub, err := host.EventBus().Subscribe(new(event.EvtPeerConnectednessChanged))
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return
+	}
+	defer sub.Close()
+
+	ticker := time.NewTicker(bandwidthPruneInterval)
+	defer ticker.Stop()
+
+	connected := func(p peer.ID) bool {
+		return host.Network().Connectedness(p) == network.Connected
+	}
+
+	for {
+		select {
+		case evt := <-sub.Out():
+			e, ok := evt.(event.EvtPeerConnectednessChanged)
+			if ok && e.Connectedness == network.NotConnected {
+				peersDB.Bandwidth.PeerDisconnected(e.Peer)
+			}
+		case <-ticker.C:
+			peersDB.Bandwidth.Prune(connected)
+		}
+	}
+}
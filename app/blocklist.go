@@ -0,0 +1,183 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"peersdb/config"
+	"sort"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// persisted list of blocked peer ids and orbitdb identities. Blocked peers can
+// not connect to us, their pubsub messages are dropped and entries signed by
+// blocked identities are not replicated.
+//
+// The blocklist is the connection gater of the libp2p host.
+type Blocklist struct {
+	mtx     sync.RWMutex
+	blocked map[string]bool
+}
+
+// the file the blocklist is persisted in
+func blocklistPath() string {
+	return *config.FlagRepo + "_blocklist"
+}
+
+// loads the persisted blocklist, an empty list is returned if there is none
+func LoadBlocklist() (*Blocklist, error) {
+	bl := &Blocklist{blocked: make(map[string]bool)}
+
+	data, err := ioutil.ReadFile(blocklistPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return bl, nil
+		}
+		return nil, err
+	}
+
+	var ids []string
+	err = json.Unmarshal(data, &ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		bl.blocked[id] = true
+	}
+
+	return bl, nil
+}
+
+// returns all blocked ids sorted
+func (bl *Blocklist) List() []string {
+	bl.mtx.RLock()
+	defer bl.mtx.RUnlock()
+	return bl.list()
+}
+
+func (bl *Blocklist) list() []string {
+	res := make([]string, 0, len(bl.blocked))
+	for id := range bl.blocked {
+		res = append(res, id)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// blocks a peer id or orbitdb identity and persists the list
+func (bl *Blocklist) Block(id string) error {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+	bl.blocked[id] = true
+	return config.SaveStructAsJSON(bl.list(), blocklistPath())
+}
+
+// unblocks a peer id or orbitdb identity and persists the list
+func (bl *Blocklist) Unblock(id string) error {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	if !bl.blocked[id] {
+		return errors.New(id + " is not blocked")
+	}
+	delete(bl.blocked, id)
+
+	return config.SaveStructAsJSON(bl.list(), blocklistPath())
+}
+
+// checks whether a peer id or orbitdb identity is blocked
+func (bl *Blocklist) IsBlocked(id string) bool {
+	bl.mtx.RLock()
+	defer bl.mtx.RUnlock()
+	return bl.blocked[id]
+}
+
+func (bl *Blocklist) InterceptPeerDial(p peer.ID) bool {
+	return !bl.IsBlocked(p.String())
+}
+
+func (bl *Blocklist) InterceptAddrDial(p peer.ID, _ ma.Multiaddr) bool {
+	return !bl.IsBlocked(p.String())
+}
+
+// the peer id is not known before the handshake, see InterceptSecured
+func (bl *Blocklist) InterceptAccept(_ network.ConnMultiaddrs) bool {
+	return true
+}
+
+func (bl *Blocklist) InterceptSecured(_ network.Direction, p peer.ID, _ network.ConnMultiaddrs) bool {
+	return !bl.IsBlocked(p.String())
+}
+
+func (bl *Blocklist) InterceptUpgraded(_ network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
+
+// executes disconnect command, closes all connections to the peer. The peer is
+// forgotten as known peer and not dialed again until it's connected to
+// explicitly, but it may still connect to us.
+func disconnect(peersDB *PeersDB, id string, logChan chan Log) interface{} {
+	p, err := peer.Decode(id)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	// before closing, so the disconnect does not trigger a reconnect
+	err = peersDB.KnownPeers.Disconnect(id)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	err = peersDB.Node.PeerHost.Network().ClosePeer(p)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return "Disconnected from " + id
+}
+
+// executes block command. Peer ids are disconnected and forgotten as known
+// peer, anything else is treated as orbitdb identity.
+func block(peersDB *PeersDB, id string, logChan chan Log) interface{} {
+	err := peersDB.Blocklist.Block(id)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	p, err := peer.Decode(id)
+	if err != nil {
+		return "Blocked identity " + id
+	}
+
+	// a known peer would be reconnected to otherwise
+	peersDB.KnownPeers.Remove(id)
+	peersDB.Node.PeerHost.ConnManager().Unprotect(p, storePeerTag)
+
+	err = peersDB.Node.PeerHost.Network().ClosePeer(p)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return "Blocked peer " + id
+}
+
+// executes unblock command
+func unblock(peersDB *PeersDB, id string, logChan chan Log) interface{} {
+	err := peersDB.Blocklist.Unblock(id)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	return "Unblocked " + id
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"time"
+
+	"berty.tech/go-orbit-db/stores"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/net/context"
+)
+
+// the connection manager tag of peers hosting our contributions store
+const storePeerTag = "peersdb-store"
+
+// protects the connections to peers hosting our contributions store, so the
+// connection manager does not prune them when reaching the high watermark
+func protectStorePeers(peersDB *PeersDB, logChan chan Log) {
+	// since contributions datastore may be nil, wait till it isn't
+	for peersDB.Contributions == nil {
+		time.Sleep(time.Second)
+	}
+	contributions := *peersDB.Contributions
+
+	// subscribe first, so no peer joining in between goes unnoticed
+	sub, err := contributions.EventBus().Subscribe(new(stores.EventNewPeer))
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+	defer sub.Close()
+
+	// orbitdb exchanges heads on a pubsub topic named after the store address
+	coreAPI := (*peersDB.Orbit).IPFS()
+	topic := contributions.Address().String()
+	peers, err := coreAPI.PubSub().Peers(context.Background(), options.PubSub.Topic(topic))
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+	}
+	for _, p := range peers {
+		protectPeer(peersDB, p)
+	}
+
+	for e := range sub.Out() {
+		e, ok := e.(stores.EventNewPeer)
+		if !ok {
+			continue
+		}
+		protectPeer(peersDB, e.Peer)
+	}
+}
+
+func protectPeer(peersDB *PeersDB, id peer.ID) {
+	peersDB.Node.PeerHost.ConnManager().Protect(id, storePeerTag)
+}
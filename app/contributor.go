@@ -0,0 +1,70 @@
+package app
+
+import (
+	"errors"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// the bytes a contributor signs, they bind the contribution to the orbitdb
+// identity which signs its eventlog entry
+func contributionPayload(c *Contribution, identity string) []byte {
+	payload := identity + "\n" + c.Path + "\n" + c.CreationTS.UTC().Format(time.RFC3339Nano)
+	return []byte(payload)
+}
+
+// signs the contribution with the libp2p key of this node, so others can check
+// that the contributor's peer id and the entry's identity belong together
+func signContribution(peersDB *PeersDB, c *Contribution) error {
+	return signContributionWith(peersDB, c, peersDB.Node.PrivateKey)
+}
+
+// signs the contribution with the given libp2p key, which has to be the
+// contributor's, e.g. one of our keys from before a rotation
+func signContributionWith(peersDB *PeersDB, c *Contribution, privKey crypto.PrivKey) error {
+	key, err := crypto.MarshalPublicKey(privKey.GetPublic())
+	if err != nil {
+		return err
+	}
+
+	identity := (*peersDB.Orbit).Identity().ID
+	sig, err := privKey.Sign(contributionPayload(c, identity))
+	if err != nil {
+		return err
+	}
+
+	c.ContributorKey = key
+	c.Signature = sig
+	return nil
+}
+
+// checks that the declared contributor signed the contribution for the
+// identity which signed the eventlog entry
+func verifyContributor(c Contribution, signer string) error {
+	if len(c.Signature) == 0 || len(c.ContributorKey) == 0 {
+		return errors.New("contribution is not signed by its contributor")
+	}
+
+	key, err := crypto.UnmarshalPublicKey(c.ContributorKey)
+	if err != nil {
+		return err
+	}
+	id, err := peer.IDFromPublicKey(key)
+	if err != nil {
+		return err
+	}
+	if id.String() != c.Contributor {
+		return errors.New("key does not belong to contributor " + c.Contributor)
+	}
+
+	ok, err := key.Verify(contributionPayload(&c, signer), c.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("contributor " + c.Contributor + " did not sign for identity " + signer)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package app
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/crypto/curve25519"
+)
+
+// how an encrypted contribution's content key is distributed. The content is
+// encrypted with a random AES-256-GCM key, which is wrapped for every recipient.
+// For ed25519 peer keys it's wrapped with a key agreed between an ephemeral
+// X25519 key and the X25519 form of the recipient's key, for rsa peer keys with
+// RSA-OAEP.
+type Encryption struct {
+	EphemeralKey []byte            `json:"ephemeralKey"`
+	Keys         map[string][]byte `json:"keys"` // wrapped content key per peer id
+}
+
+// the field prime of curve25519, 2^255 - 19
+var curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// converts an ed25519 public key into the X25519 public key of the same
+// secret, u = (1 + y) / (1 - y)
+func x25519Public(key crypto.PubKey) ([]byte, error) {
+	raw, err := key.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	// y is encoded little endian, the highest bit is the sign of x
+	yBytes := make([]byte, 32)
+	for i := range raw {
+		yBytes[31-i] = raw[i]
+	}
+	yBytes[0] &= 0x7f
+	y := new(big.Int).SetBytes(yBytes)
+
+	num := new(big.Int).Add(big.NewInt(1), y)
+	den := new(big.Int).Sub(big.NewInt(1), y)
+	den.Mod(den, curve25519P)
+	if den.Sign() == 0 {
+		return nil, errors.New("invalid ed25519 key")
+	}
+	u := num.Mul(num, den.ModInverse(den, curve25519P))
+	u.Mod(u, curve25519P)
+
+	uBytes := u.FillBytes(make([]byte, 32))
+	for i, j := 0, 31; i < j; i, j = i+1, j-1 {
+		uBytes[i], uBytes[j] = uBytes[j], uBytes[i]
+	}
+	return uBytes, nil
+}
+
+// converts an ed25519 private key into the X25519 scalar of the same secret
+func x25519Private(key crypto.PrivKey) ([]byte, error) {
+	raw, err := key.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	// the first 32 bytes are the seed, curve25519 clamps the hash itself
+	h := sha512.Sum512(raw[:32])
+	return h[:32], nil
+}
+
+// seals data with AES-256-GCM, the random nonce is prepended
+func seal(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// opens data sealed by seal
+func open(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// derives the key wrapping the content key for one recipient from the secret
+// both sides agreed on
+func wrappingKey(shared []byte, ephemeral []byte, recipient []byte) []byte {
+	h := sha256.New()
+	h.Write(shared)
+	h.Write(ephemeral)
+	h.Write(recipient)
+	return h.Sum(nil)
+}
+
+// the label of the RSA-OAEP wrapped content keys
+var rsaWrapLabel = []byte("peersdb-content-key")
+
+// wraps the content key for a recipient's public key
+func wrapKey(contentKey []byte, ephSecret []byte, ephPublic []byte, pub crypto.PubKey) ([]byte, error) {
+	switch pub.Type() {
+	case crypto.Ed25519:
+		recipient, err := x25519Public(pub)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := curve25519.X25519(ephSecret, recipient)
+		if err != nil {
+			return nil, err
+		}
+		return seal(wrappingKey(shared, ephPublic, recipient), contentKey)
+
+	case crypto.RSA:
+		stdKey, err := crypto.PubKeyToStdKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := stdKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("invalid rsa key")
+		}
+		return rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaKey, contentKey, rsaWrapLabel)
+
+	default:
+		return nil, errors.New("encryption needs ed25519 or rsa peer keys")
+	}
+}
+
+// unwraps the content key wrapped for our private key
+func unwrapKey(wrapped []byte, enc *Encryption, key crypto.PrivKey) ([]byte, error) {
+	switch key.Type() {
+	case crypto.Ed25519:
+		secret, err := x25519Private(key)
+		if err != nil {
+			return nil, err
+		}
+		public, err := curve25519.X25519(secret, curve25519.Basepoint)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := curve25519.X25519(secret, enc.EphemeralKey)
+		if err != nil {
+			return nil, err
+		}
+		return open(wrappingKey(shared, enc.EphemeralKey, public), wrapped)
+
+	case crypto.RSA:
+		stdKey, err := crypto.PrivKeyToStdKey(key)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := stdKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("invalid rsa key")
+		}
+		return rsa.DecryptOAEP(sha256.New(), rand.Reader, rsaKey, wrapped, rsaWrapLabel)
+
+	default:
+		return nil, errors.New("encryption needs ed25519 or rsa peer keys")
+	}
+}
+
+// encrypts data for the given peer ids, pubKey returns the public key of a
+// recipient
+func encrypt(data []byte, recipients []string,
+	pubKey func(peer.ID) (crypto.PubKey, error)) ([]byte, *Encryption, error) {
+
+	contentKey := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, contentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := seal(contentKey, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ephSecret := make([]byte, curve25519.ScalarSize)
+	_, err = io.ReadFull(rand.Reader, ephSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephPublic, err := curve25519.X25519(ephSecret, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc := &Encryption{EphemeralKey: ephPublic, Keys: make(map[string][]byte)}
+	for _, r := range recipients {
+		id, err := peer.Decode(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		pub, err := pubKey(id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		enc.Keys[r], err = wrapKey(contentKey, ephSecret, ephPublic, pub)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return ciphertext, enc, nil
+}
+
+// decrypts data with the content key wrapped for us
+func decrypt(data []byte, enc *Encryption, id string, key crypto.PrivKey) ([]byte, error) {
+	wrapped, ok := enc.Keys[id]
+	if !ok {
+		return nil, errors.New("this contribution is encrypted and no key was shared with us")
+	}
+
+	contentKey, err := unwrapKey(wrapped, enc, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(contentKey, data)
+}
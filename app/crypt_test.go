@@ -0,0 +1,152 @@
+package app
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/crypto/curve25519"
+)
+
+// a peer of the given key type
+type testPeer struct {
+	id  peer.ID
+	key crypto.PrivKey
+}
+
+func newTestPeer(t *testing.T, typ int) testPeer {
+	t.Helper()
+	key, _, err := crypto.GenerateKeyPair(typ, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testPeer{id, key}
+}
+
+// looks up the public keys of the given peers
+func pubKeys(peers ...testPeer) func(peer.ID) (crypto.PubKey, error) {
+	return func(id peer.ID) (crypto.PubKey, error) {
+		for _, p := range peers {
+			if p.id == id {
+				return p.key.GetPublic(), nil
+			}
+		}
+		return nil, errors.New("unknown peer " + id.String())
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	for name, typ := range map[string]int{"ed25519": crypto.Ed25519, "rsa": crypto.RSA} {
+		t.Run(name, func(t *testing.T) {
+			p := newTestPeer(t, typ)
+			data := []byte("a contribution")
+
+			ciphertext, enc, err := encrypt(data, []string{p.id.String()}, pubKeys(p))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(ciphertext, data) {
+				t.Fatal("ciphertext contains the plaintext")
+			}
+
+			plaintext, err := decrypt(ciphertext, enc, p.id.String(), p.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(plaintext, data) {
+				t.Fatalf("got %q, want %q", plaintext, data)
+			}
+		})
+	}
+}
+
+func TestEncryptMixedRecipients(t *testing.T) {
+	peers := []testPeer{newTestPeer(t, crypto.Ed25519), newTestPeer(t, crypto.RSA)}
+	data := []byte("for both")
+
+	ciphertext, enc, err := encrypt(data,
+		[]string{peers[0].id.String(), peers[1].id.String()}, pubKeys(peers...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range peers {
+		plaintext, err := decrypt(ciphertext, enc, p.id.String(), p.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plaintext, data) {
+			t.Fatalf("got %q, want %q", plaintext, data)
+		}
+	}
+}
+
+func TestDecryptWrongRecipient(t *testing.T) {
+	for name, typ := range map[string]int{"ed25519": crypto.Ed25519, "rsa": crypto.RSA} {
+		t.Run(name, func(t *testing.T) {
+			recipient := newTestPeer(t, typ)
+			other := newTestPeer(t, typ)
+
+			ciphertext, enc, err := encrypt([]byte("secret"), []string{recipient.id.String()},
+				pubKeys(recipient))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// no key was wrapped for the other peer
+			_, err = decrypt(ciphertext, enc, other.id.String(), other.key)
+			if err == nil {
+				t.Fatal("decrypted without a wrapped key")
+			}
+
+			// the recipient's wrapped key doesn't open with the other key
+			_, err = decrypt(ciphertext, enc, recipient.id.String(), other.key)
+			if err == nil {
+				t.Fatal("decrypted with the wrong key")
+			}
+		})
+	}
+}
+
+func TestX25519Conversion(t *testing.T) {
+	// both sides of an agreement have to derive the same secret from the
+	// converted ed25519 keys
+	p := newTestPeer(t, crypto.Ed25519)
+	pub, err := x25519Public(p.key.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := x25519Private(p.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eph := make([]byte, 32)
+	_, err = rand.Read(eph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ephPub, err := curve25519.X25519(eph, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := curve25519.X25519(eph, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := curve25519.X25519(priv, ephPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Fatal("the converted keys don't agree on a secret")
+	}
+}
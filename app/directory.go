@@ -0,0 +1,160 @@
+package app
+
+import (
+	"encoding/json"
+	"peersdb/config"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"golang.org/x/net/context"
+)
+
+// the pubsub topic all peersdb nodes announce themselves on
+const heartbeatTopic = "peersdb-heartbeat"
+
+// periodically published by every node to tell others it's alive
+type Heartbeat struct {
+	PeerID   string   `json:"peerID"`
+	Version  string   `json:"version"`
+	Stores   []string `json:"stores"` // addresses of the stores this node holds
+	Region   string   `json:"region"`
+	HTTPPort string   `json:"httpPort"` // empty if the http api is disabled
+	Pins     int      `json:"pins"`     // number of recursive pins
+}
+
+// a peer which recently sent a heartbeat
+type DirectoryEntry struct {
+	Heartbeat
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// all peersdb nodes which sent a heartbeat lately
+type PeerDirectory struct {
+	mtx     sync.Mutex
+	entries map[string]*DirectoryEntry
+}
+
+func NewPeerDirectory() *PeerDirectory {
+	return &PeerDirectory{entries: make(map[string]*DirectoryEntry)}
+}
+
+// returns all live entries sorted by peer id, stale entries are dropped
+func (pd *PeerDirectory) List() []DirectoryEntry {
+	pd.mtx.Lock()
+	defer pd.mtx.Unlock()
+
+	expiry := time.Now().Add(-*config.FlagPeerExpiry)
+	res := make([]DirectoryEntry, 0, len(pd.entries))
+	for id, e := range pd.entries {
+		if e.LastSeen.Before(expiry) {
+			delete(pd.entries, id)
+			continue
+		}
+		res = append(res, *e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].PeerID < res[j].PeerID })
+
+	return res
+}
+
+func (pd *PeerDirectory) update(hb Heartbeat) {
+	pd.mtx.Lock()
+	defer pd.mtx.Unlock()
+	pd.entries[hb.PeerID] = &DirectoryEntry{hb, time.Now()}
+}
+
+// publishes heartbeats in the configured interval
+func sendHeartbeats(peersDB *PeersDB, logChan chan Log) {
+	interval := *config.FlagHeartbeatInterval
+	if interval <= 0 {
+		return
+	}
+
+	coreAPI := (*peersDB.Orbit).IPFS()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx := context.Background()
+		data, err := json.Marshal(heartbeat(ctx, peersDB))
+		if err != nil {
+			logChan <- Log{RecoverableErr, err}
+			return
+		}
+
+		err = coreAPI.PubSub().Publish(ctx, heartbeatTopic, data)
+		if err != nil {
+			logChan <- Log{RecoverableErr, err}
+		}
+
+		<-ticker.C
+	}
+}
+
+// gathers the information announced in our heartbeat
+func heartbeat(ctx context.Context, peersDB *PeersDB) Heartbeat {
+	hb := Heartbeat{
+		PeerID:  peersDB.Config.PeerID,
+		Version: Version,
+		Stores:  []string{},
+		Region:  *config.FlagRegion,
+	}
+	if *config.FlagHTTP {
+		hb.HTTPPort = *config.FlagHTTPPort
+	}
+	if peersDB.Contributions != nil {
+		hb.Stores = append(hb.Stores, (*peersDB.Contributions).Address().String())
+	}
+	if peersDB.Annotations != nil {
+		hb.Stores = append(hb.Stores, (*peersDB.Annotations).Address().String())
+	}
+
+	coreAPI := (*peersDB.Orbit).IPFS()
+	pins, err := coreAPI.Pin().Ls(ctx, options.Pin.Ls.Recursive())
+	if err == nil {
+		for p := range pins {
+			if p.Err() == nil {
+				hb.Pins++
+			}
+		}
+	}
+
+	return hb
+}
+
+// receives the heartbeats of other nodes and keeps the directory up to date
+func awaitHeartbeats(peersDB *PeersDB, logChan chan Log) {
+	coreAPI := (*peersDB.Orbit).IPFS()
+	ctx := context.Background()
+	sub, err := coreAPI.PubSub().Subscribe(ctx, heartbeatTopic)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+	defer sub.Close()
+
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			logChan <- Log{RecoverableErr, err}
+			return
+		}
+
+		var hb Heartbeat
+		err = json.Unmarshal(msg.Data(), &hb)
+		if err != nil {
+			logChan <- Log{RecoverableErr, err}
+			continue
+		}
+
+		// nobody may announce itself in the name of another peer
+		if hb.PeerID != msg.From().String() || hb.PeerID == peersDB.Config.PeerID ||
+			peersDB.Blocklist.IsBlocked(hb.PeerID) {
+			continue
+		}
+
+		peersDB.Directory.update(hb)
+	}
+}
@@ -0,0 +1,139 @@
+package app
+
+import (
+	"errors"
+	"peersdb/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
+	"golang.org/x/net/context"
+)
+
+// how often the dht is asked for new peers of our store
+const discoveryInterval = time.Minute
+
+// derives the dht rendezvous namespace from a contributions store address of
+// the form /orbitdb/<root cid>/<name>
+func storeNamespace(storeAddr string) (string, error) {
+	parts := strings.Split(strings.Trim(storeAddr, "/"), "/")
+	if len(parts) < 2 || parts[0] != "orbitdb" {
+		return "", errors.New("not an orbitdb address : " + storeAddr)
+	}
+	return "peersdb/contributions/" + parts[1], nil
+}
+
+// the address of the store we want peers for. That's the open contributions
+// store or, if there is none yet, the store given via flag
+func wantedStore(peersDB *PeersDB) string {
+	if peersDB.Contributions != nil {
+		return (*peersDB.Contributions).Address().String()
+	}
+	return *config.FlagStore
+}
+
+// advertises the contributions store under its rendezvous namespace and
+// connects to the other peers found there. A node without a store replicates
+// the one given by -store from them.
+func discoverStorePeers(peersDB *PeersDB, logChan chan Log) {
+	if !*config.FlagDiscovery {
+		return
+	}
+
+	disc := drouting.NewRoutingDiscovery(peersDB.Node.Routing)
+	advertised := make(map[string]bool)
+
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		discover(peersDB, disc, advertised, logChan)
+		<-ticker.C
+	}
+}
+
+// runs a single discovery round for the wanted store
+func discover(peersDB *PeersDB, disc *drouting.RoutingDiscovery,
+	advertised map[string]bool, logChan chan Log) {
+
+	storeAddr := wantedStore(peersDB)
+	if storeAddr == "" {
+		return
+	}
+	ns, err := storeNamespace(storeAddr)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+
+	// only nodes holding the store advertise it, advertising keeps running in
+	// the background
+	ctx := context.Background()
+	if peersDB.Contributions != nil && !advertised[ns] {
+		dutil.Advertise(ctx, disc, ns)
+		advertised[ns] = true
+	}
+
+	findCtx, cancel := context.WithTimeout(ctx, discoveryInterval)
+	peers, err := dutil.FindPeers(findCtx, disc, ns)
+	cancel()
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+
+	connectDiscovered(peersDB, peers, logChan)
+
+	// the store given via flag is replicated from the peers found
+	if peersDB.Contributions == nil && *config.FlagStore != "" {
+		logChan <- Log{Info, "Replicate db " + *config.FlagStore}
+		err = replicateStore(ctx, peersDB, *config.FlagStore)
+		if err != nil {
+			logChan <- Log{RecoverableErr, err}
+		}
+	}
+}
+
+// connects to discovered peers we are not connected to yet, the same way the
+// connect command does
+func connectDiscovered(peersDB *PeersDB, peers []peer.AddrInfo, logChan chan Log) {
+	host := peersDB.Node.PeerHost
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, p := range peers {
+		if p.ID == host.ID() || len(p.Addrs) == 0 {
+			continue
+		}
+		if host.Network().Connectedness(p.ID) == network.Connected ||
+			peersDB.KnownPeers.IsDisconnected(p.ID.String()) {
+			continue
+		}
+
+		p2pAddrs, err := peer.AddrInfoToP2pAddrs(&p)
+		if err != nil {
+			continue
+		}
+		var addrs []string
+		for _, a := range p2pAddrs {
+			addrs = append(addrs, a.String())
+		}
+		logChan <- Log{Info, "Discovered peer " + p.ID.String()}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := connectPeer(ctx, peersDB, addrs)
+			if err != nil {
+				logChan <- Log{RecoverableErr, err}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"peersdb/config"
+	"peersdb/ipfs"
+
+	kuboConfig "github.com/ipfs/kubo/config"
+)
+
+// executes identity-export command, writes the node's private key to a file
+func exportIdentity(peersDB *PeersDB, dest string, logChan chan Log) interface{} {
+	dest, err := expandHome(dest)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	err = ipfs.ExportIdentity(peersDB.Node, dest)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return "Exported identity " + peersDB.Config.PeerID + " to " + dest
+}
+
+// executes identity-import command, the imported identity is used after the
+// next restart
+func importIdentity(peersDB *PeersDB, src string, logChan chan Log) interface{} {
+	src, err := expandHome(src)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	id, err := ipfs.ReadIdentity(src)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return replaceIdentity(peersDB, id, logChan)
+}
+
+// executes identity-rotate command, the new key is used after the next
+// restart
+func rotateIdentity(peersDB *PeersDB, keyType string, logChan chan Log) interface{} {
+	id, err := ipfs.NewIdentity(keyType, *config.FlagKeyBits)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return replaceIdentity(peersDB, id, logChan)
+}
+
+// stores the new identity in the repo. The orbitdb identity is kept, it's
+// persisted in the config before the peer id changes.
+func replaceIdentity(peersDB *PeersDB, id kuboConfig.Identity, logChan chan Log) interface{} {
+	err := config.SaveStructAsJSON(peersDB.Config, *config.FlagRepo+"_config")
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	err = ipfs.SetIdentity(peersDB.Node, id)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return "The node will use peer id " + id.PeerID + " after a restart, the orbitdb identity " +
+		"stays " + (*peersDB.Orbit).Identity().ID
+}
@@ -5,19 +5,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"peersdb/config"
 	"peersdb/ipfs"
+	"strings"
+	"time"
 
 	orbitdb "berty.tech/go-orbit-db"
 	"berty.tech/go-orbit-db/accesscontroller"
 	"berty.tech/go-orbit-db/iface"
 	"berty.tech/go-orbit-db/stores/documentstore"
 	"github.com/ipfs/kubo/core/coreapi"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	ma "github.com/multiformats/go-multiaddr"
 	"go.uber.org/zap"
 )
 
@@ -38,13 +41,56 @@ func InitPeer(peersDB *PeersDB, bench *Benchmark) error {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Couldn't load config : %+v\n", err)
 	}
+	peersDB.Config = conf
+
+	// load persistent known peers
+	peersDB.KnownPeers, err = LoadKnownPeers()
+	if err != nil {
+		return err
+	}
+	peersDB.Directory = NewPeerDirectory()
+	peersDB.Moderation = NewModeration()
+
+	peersDB.Audit, err = OpenAuditLog()
+	if err != nil {
+		return err
+	}
+
+	// load persistent blocklist, it gates all connections of the node
+	peersDB.Blocklist, err = LoadBlocklist()
+	if err != nil {
+		return err
+	}
+
+	// load persistent redeemed invites, each write invite may be used once
+	peersDB.RedeemedInvites, err = LoadRedeemedInvites()
+	if err != nil {
+		return err
+	}
+
+	peersDB.APIClient, err = NewAPIClient()
+	if err != nil {
+		return err
+	}
+
+	// limits are given in KiB/s
+	peersDB.Bandwidth = ipfs.NewBandwidthMeter(int64(*config.FlagRateLimit)*1024,
+		int64(*config.FlagPeerRateLimit)*1024)
 
 	// start ipfs node
-	node, err := ipfs.SpawnEphemeral(ctx)
+	node, err := ipfs.SpawnEphemeral(ctx, peersDB.Blocklist, peersDB.Bandwidth, scoredTopics)
 	if err != nil {
 		return err
 	}
+	// nodes which were started before the orbitdb identity was decoupled from
+	// the peer id used their peer id
+	if conf.OrbitID == "" {
+		conf.OrbitID = conf.PeerID
+	}
 	conf.PeerID = node.Identity.String()
+	if conf.OrbitID == "" {
+		conf.OrbitID = conf.PeerID
+	}
 	peersDB.Node = node
 
 	coreAPI, err := coreapi.NewCoreAPI(node)
@@ -62,17 +108,16 @@ func InitPeer(peersDB *PeersDB, bench *Benchmark) error {
 	}
 
 	// set cache dir
-	cacheDir := filepath.Join(os.Getenv("HOME"), ".cache")
-	cache := filepath.Join(cacheDir, "peersdb", *config.FlagRepo, "orbitdb")
+	cache := orbitCacheDir()
 
 	// set orbitdb create options
 	orbitopts := &orbitdb.NewOrbitDBOptions{
 		Logger:    devLog,
 		Directory: &cache,
 	}
-	if conf.PeerID != "" {
+	if conf.OrbitID != "" {
 		// TODO : if this does not work store and set Identitiy as non-string
-		orbitopts.ID = &conf.PeerID
+		orbitopts.ID = &conf.OrbitID
 	}
 
 	// start orbitdb instance
@@ -82,14 +127,8 @@ func InitPeer(peersDB *PeersDB, bench *Benchmark) error {
 	}
 	peersDB.Orbit = &orbit
 
-	// give write access to all
-	ac := &accesscontroller.CreateAccessControllerOptions{
-		Access: map[string][]string{
-			"write": {
-				"*",
-			},
-		},
-	}
+	// only a root node creates the store, with the configured writers
+	ac := contributionsAccess(peersDB)
 
 	// enable create if this is a root node
 	storeType := "eventlog"
@@ -108,11 +147,20 @@ func InitPeer(peersDB *PeersDB, bench *Benchmark) error {
 		fmt.Fprintf(os.Stderr, "%v\nTry resolving it by connecting to a peer\n", err)
 	} else {
 		db := store.(iface.EventLogStore)
-		db.Load(ctx, -1)
+		err = loadContributions(ctx, peersDB, db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't load contributions : %+v\n", err)
+		}
 		peersDB.Contributions = &db
 
 		// persist store address
 		conf.ContributionsStoreAddr = db.Address().String()
+
+		// the annotations belong to the contributions
+		err = openAnnotations(ctx, peersDB)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't open annotations : %+v\n", err)
+		}
 	}
 
 	// a creatable docsstore which no other peer can read or write to
@@ -155,7 +203,6 @@ func InitPeer(peersDB *PeersDB, bench *Benchmark) error {
 		conf.ValidationsStoreAddr = db.Address().String()
 	}
 
-	peersDB.Config = conf
 	if bench != nil {
 		peersDB.Benchmark = bench
 	} else {
@@ -166,34 +213,85 @@ func InitPeer(peersDB *PeersDB, bench *Benchmark) error {
 		peersDB.Benchmark.Region = *config.FlagRegion
 	}
 
-	// connect to a bootstrap peer
+	// connect to bootstrap peers
 	if *config.FlagBootstrap != "" {
 		fmt.Print("\nbootstrap : ", *config.FlagBootstrap, "\n")
-		IssueConnectCmd(peersDB, []string{*config.FlagBootstrap})
+		bootstrap(peersDB, strings.Split(*config.FlagBootstrap, ","))
 	}
 
 	return nil
 }
 
+// the directory orbitdb stores its caches in
+func orbitCacheDir() string {
+	cacheDir := filepath.Join(os.Getenv("HOME"), ".cache")
+	return filepath.Join(cacheDir, "peersdb", *config.FlagRepo, "orbitdb")
+}
+
+// connects to the given bootstrap peers. Full multiaddrs are dialed directly
+// via libp2p, plain IPs fall back to the http based IssueConnectCmd
+func bootstrap(peersDB *PeersDB, peers []string) {
+	var addrs, ips []string
+	for _, p := range peers {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "/") {
+			addrs = append(addrs, p)
+		} else if p != "" {
+			ips = append(ips, p)
+		}
+	}
+
+	if len(addrs) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := ipfs.ConnectToPeers(ctx, peersDB.Orbit, addrs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't connect to bootstrap peers : %+v\n", err)
+		}
+
+		// remember the bootstrap peers we could reach
+		for _, a := range addrs {
+			maddr, err := ma.NewMultiaddr(a)
+			if err != nil {
+				continue
+			}
+			info, err := peer.AddrInfoFromP2pAddr(maddr)
+			if err != nil {
+				continue
+			}
+			err = recordPeer(peersDB, info.ID, []string{a})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Bootstrap peer unreachable : %+v\n", err)
+			}
+		}
+	}
+
+	// legacy fallback, requires the other side to run the http api on port 8080
+	if len(ips) > 0 {
+		IssueConnectCmd(peersDB, ips)
+	}
+}
+
 // connect to a peer given their IP, by sending an http request for the "CONNECT"
 // cmd, with own connection string
 func IssueConnectCmd(peersDB *PeersDB, peers []string) {
-	client := &http.Client{}
-
 	// for each given ip, send the connect request
 	for _, p := range peers {
-		// TODO : can we get the address from the coreapi ?
-		myIP := getOwnIP()
-		if p == "127.0.0.1" {
-			myIP = p
+		// peers on the same machine can reach us via loopback, all others need
+		// one of the addresses the host announces
+		addrs := ipfs.PeerAddrs(peersDB.Node, p == "127.0.0.1")
+		if len(addrs) == 0 {
+			fmt.Println("No address to send to IP", p)
+			continue
 		}
-		myAddr := "/ip4/" + myIP + "/tcp/" + *config.FlagIPFSPort + "/p2p/" + peersDB.Config.PeerID
+		myAddr := addrs[0]
 		fmt.Print("\n sending my address : ", myAddr, " to IP ", p, "\n")
 
 		// TODO : port may be different aswell
-		cmdPath := "http://" + p + ":8080/peersdb/command"
+		cmdPath := APIScheme() + "://" + p + ":8080/peersdb/command"
 
-		connectReq := Request{CONNECT, []string{myAddr}}
+		connectReq := Request{Method: CONNECT, Args: []string{myAddr}}
 		jsonData, err := json.Marshal(connectReq)
 		if err != nil {
 			fmt.Println("Error marshaling JSON:", err)
@@ -205,8 +303,11 @@ func IssueConnectCmd(peersDB *PeersDB, peers []string) {
 			fmt.Println("Error creating request:", err)
 			continue
 		}
+		if peersDB.Config.PeerAPIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+peersDB.Config.PeerAPIKey)
+		}
 
-		resp, err := client.Do(req)
+		resp, err := peersDB.APIClient.Do(req)
 		if err != nil {
 			fmt.Println("Error sending request:", err)
 			continue
@@ -214,37 +315,3 @@ func IssueConnectCmd(peersDB *PeersDB, peers []string) {
 		defer resp.Body.Close()
 	}
 }
-
-func getOwnIP() string {
-	// get the list of network interfaces
-	interfaces, err := net.Interfaces()
-	if err != nil {
-		fmt.Println("Failed to get network interfaces:", err)
-		return ""
-	}
-
-	// iterate through each network interface
-	for _, iface := range interfaces {
-		// check if the interface is up and not a loopback
-		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagLoopback == 0 {
-			// get the addresses for the current interface
-			addrs, err := iface.Addrs()
-			if err != nil {
-				fmt.Println("Failed to get addresses for interface", iface.Name, ":", err)
-				continue
-			}
-
-			// iterate through each address
-			for _, addr := range addrs {
-				// check if the address is an IP address
-				ipNet, ok := addr.(*net.IPNet)
-				if ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
-					// print the IP address
-					return ipNet.IP.String()
-				}
-			}
-		}
-	}
-
-	return ""
-}
@@ -0,0 +1,500 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"peersdb/config"
+	"peersdb/ipfs"
+	"sync"
+	"time"
+
+	"berty.tech/go-ipfs-log/identityprovider"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/net/context"
+)
+
+// roles an invite can grant
+const (
+	readRole  = "read"
+	writeRole = "write"
+)
+
+// the topic prefix admins receive join requests on, followed by their peer id
+const joinTopicPrefix = "peersdb-join/"
+
+// an invitation to the contributions store of the issuer
+type Invite struct {
+	ID        string    `json:"id"`        // random, write invites can only be redeemed once
+	Store     string    `json:"store"`     // address of the contributions store
+	Bootstrap []string  `json:"bootstrap"` // multiaddrs of the issuer
+	Role      string    `json:"role"`      // read or write
+	Issuer    string    `json:"issuer"`    // peer id of the issuer
+	IssuerKey []byte    `json:"issuerKey"` // libp2p public key of the issuer
+	Expires   time.Time `json:"expires"`
+}
+
+// the invite together with the issuer's signature, base64 encoded this is the
+// token handed to the invitee
+type signedInvite struct {
+	Invite    []byte `json:"invite"`
+	Signature []byte `json:"signature"`
+}
+
+// sent by a joining node to the issuer to get write access. The claim is
+// encrypted for the issuer, so other subscribers of the join topic can't take
+// the token.
+type JoinRequest struct {
+	Claim      []byte     `json:"claim"` // the encrypted joinClaim
+	Encryption Encryption `json:"encryption"`
+}
+
+// the token together with the orbitdb identity it's redeemed for, signed by
+// that identity
+type joinClaim struct {
+	Token     string                     `json:"token"`
+	Identity  *identityprovider.Identity `json:"identity"` // orbitdb identity of the joining node
+	Signature []byte                     `json:"signature"`
+}
+
+// the bytes a join claim's signature covers
+func joinClaimPayload(token string, identity string) []byte {
+	return []byte(token + "\n" + identity)
+}
+
+// checks that the claim was signed by the identity and that the identity's id
+// key vouches for its signing key, like orbitdb does when it creates it
+func verifyJoinClaim(claim *joinClaim) error {
+	id := claim.Identity
+	if id == nil || id.Signatures == nil {
+		return errors.New("join request without identity")
+	}
+
+	idBytes, err := hex.DecodeString(id.ID)
+	if err != nil {
+		return err
+	}
+	idKey, err := crypto.UnmarshalSecp256k1PublicKey(idBytes)
+	if err != nil {
+		return err
+	}
+	ok, err := idKey.Verify(append(append([]byte{}, id.PublicKey...), id.Signatures.ID...),
+		id.Signatures.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("identity " + id.ID + " does not vouch for its key")
+	}
+
+	key, err := id.GetPublicKey()
+	if err != nil {
+		return err
+	}
+	ok, err = key.Verify(joinClaimPayload(claim.Token, id.ID), claim.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("invalid join request signature of " + id.ID)
+	}
+	return nil
+}
+
+// executes invite command, issues a token for the given role which is valid
+// for the given duration
+func invite(peersDB *PeersDB, role string, validity string, logChan chan Log) interface{} {
+	token, err := issueInvite(peersDB, role, validity)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	return token
+}
+
+func issueInvite(peersDB *PeersDB, role string, validity string) (string, error) {
+	db := peersDB.Contributions
+	if db == nil {
+		return "", errors.New("you need a datastore first, try connecting to a peer")
+	}
+
+	if role != readRole && role != writeRole {
+		return "", fmt.Errorf("unknown role %s, try %s or %s", role, readRole, writeRole)
+	}
+	ttl, err := time.ParseDuration(validity)
+	if err != nil {
+		return "", err
+	}
+
+	// write access can only be granted by admins
+	if role == writeRole && !isAdmin(peersDB) {
+		return "", errors.New("only admins can invite writers")
+	}
+
+	// the invitee probably isn't on the same machine
+	bootstrap := ipfs.PeerAddrs(peersDB.Node, false)
+	if len(bootstrap) == 0 {
+		bootstrap = ipfs.PeerAddrs(peersDB.Node, true)
+	}
+
+	key, err := crypto.MarshalPublicKey(peersDB.Node.PrivateKey.GetPublic())
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+
+	inv := Invite{
+		ID:        hex.EncodeToString(id),
+		Store:     (*db).Address().String(),
+		Bootstrap: bootstrap,
+		Role:      role,
+		Issuer:    peersDB.Config.PeerID,
+		IssuerKey: key,
+		Expires:   time.Now().Add(ttl),
+	}
+	invJSON, err := json.Marshal(inv)
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := peersDB.Node.PrivateKey.Sign(invJSON)
+	if err != nil {
+		return "", err
+	}
+
+	tokenJSON, err := json.Marshal(signedInvite{invJSON, sig})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(tokenJSON), nil
+}
+
+// checks whether this node may administrate the contributions store
+func isAdmin(peersDB *PeersDB) bool {
+	admins, err := (*peersDB.Contributions).AccessController().GetAuthorizedByRole(adminCapability)
+	if err != nil {
+		return false
+	}
+
+	ownID := (*peersDB.Orbit).Identity().ID
+	for _, a := range admins {
+		if a == ownID {
+			return true
+		}
+	}
+	return false
+}
+
+// decodes a token and verifies that it was signed by its issuer and has not
+// expired yet
+func verifyInvite(token string) (*Invite, error) {
+	tokenJSON, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var signed signedInvite
+	err = json.Unmarshal(tokenJSON, &signed)
+	if err != nil {
+		return nil, err
+	}
+
+	var inv Invite
+	err = json.Unmarshal(signed.Invite, &inv)
+	if err != nil {
+		return nil, err
+	}
+
+	// the key has to belong to the issuer
+	key, err := crypto.UnmarshalPublicKey(inv.IssuerKey)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := peer.IDFromPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if issuer.String() != inv.Issuer {
+		return nil, errors.New("invite key does not belong to its issuer")
+	}
+
+	ok, err := key.Verify(signed.Invite, signed.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("invalid invite signature")
+	}
+
+	if time.Now().After(inv.Expires) {
+		return nil, errors.New("invite expired at " + inv.Expires.String())
+	}
+
+	return &inv, nil
+}
+
+// executes join command, connects to the issuer, replicates the store and asks
+// for write access if the invite grants it
+func join(peersDB *PeersDB, token string, logChan chan Log) interface{} {
+	inv, err := verifyInvite(token)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	if peersDB.Contributions != nil &&
+		(*peersDB.Contributions).Address().String() != inv.Store {
+		err := errors.New("this node already holds another contributions store")
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	// connect to the issuer and remember it
+	bootstrap(peersDB, inv.Bootstrap)
+
+	ctx := context.Background()
+	if peersDB.Contributions == nil {
+		err = replicateStore(ctx, peersDB, inv.Store)
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+			return err
+		}
+	}
+
+	if inv.Role != writeRole {
+		return "Joined " + inv.Store
+	}
+
+	err = requestWriteAccess(ctx, peersDB, inv, token)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return "Joined " + inv.Store + ", requested write access"
+}
+
+// sends a join request to the issuer, once it's subscribed to its join topic
+func requestWriteAccess(ctx context.Context, peersDB *PeersDB, inv *Invite, token string) error {
+	own := (*peersDB.Orbit).Identity()
+	sig, err := own.Provider.Sign(ctx, own, joinClaimPayload(token, own.ID))
+	if err != nil {
+		return err
+	}
+	claimJSON, err := json.Marshal(joinClaim{token, own.Filtered(), sig})
+	if err != nil {
+		return err
+	}
+
+	// only the issuer may read the token
+	claim, enc, err := encrypt(claimJSON, []string{inv.Issuer}, func(peer.ID) (crypto.PubKey, error) {
+		return crypto.UnmarshalPublicKey(inv.IssuerKey)
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(JoinRequest{claim, *enc})
+	if err != nil {
+		return err
+	}
+
+	coreAPI := (*peersDB.Orbit).IPFS()
+	topic := joinTopicPrefix + inv.Issuer
+
+	// pubsub needs some time to learn about the issuer's subscriptions
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	for {
+		peers, err := coreAPI.PubSub().Peers(ctx, options.PubSub.Topic(topic))
+		if err != nil {
+			return err
+		}
+		for _, p := range peers {
+			if p.String() == inv.Issuer {
+				return coreAPI.PubSub().Publish(ctx, topic, data)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.New("issuer " + inv.Issuer + " is not reachable via pubsub")
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// grants write access to nodes presenting a valid write invite issued by us
+func awaitJoinRequests(peersDB *PeersDB, logChan chan Log) {
+	coreAPI := (*peersDB.Orbit).IPFS()
+	ctx := context.Background()
+	sub, err := coreAPI.PubSub().Subscribe(ctx, joinTopicPrefix+peersDB.Config.PeerID)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+	defer sub.Close()
+
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			logChan <- Log{RecoverableErr, err}
+			return
+		}
+		if peersDB.Blocklist.IsBlocked(msg.From().String()) {
+			continue
+		}
+
+		claim, err := openJoinRequest(peersDB, msg.Data())
+		if err != nil {
+			logChan <- Log{RecoverableErr, fmt.Errorf("rejected join request of %s : %w", msg.From(), err)}
+			continue
+		}
+		identity := claim.Identity.ID
+
+		inv, err := verifyInvite(claim.Token)
+		if err != nil {
+			logChan <- Log{RecoverableErr, err}
+			continue
+		}
+
+		// only our own write invites for our store count
+		if inv.Issuer != peersDB.Config.PeerID || inv.Role != writeRole ||
+			peersDB.Contributions == nil ||
+			(*peersDB.Contributions).Address().String() != inv.Store {
+			logChan <- Log{RecoverableErr, errors.New("rejected join request of " + msg.From().String())}
+			continue
+		}
+
+		// every write invite grants a single identity
+		err = peersDB.RedeemedInvites.Redeem(inv, identity)
+		if err != nil {
+			logChan <- Log{RecoverableErr, fmt.Errorf("rejected join request of %s : %w", msg.From(), err)}
+			continue
+		}
+
+		ac := (*peersDB.Contributions).AccessController()
+		err = ac.Grant(ctx, writeCapability, identity)
+		if err != nil {
+			peersDB.RedeemedInvites.Release(inv.ID)
+			logChan <- Log{RecoverableErr, err}
+			continue
+		}
+		logChan <- Log{Info, "Granted write to " + identity + " on invite"}
+	}
+}
+
+// decrypts a join request sent to us and verifies the claim's signature
+func openJoinRequest(peersDB *PeersDB, data []byte) (*joinClaim, error) {
+	var req JoinRequest
+	err := json.Unmarshal(data, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	claimJSON, err := decrypt(req.Claim, &req.Encryption, peersDB.Config.PeerID,
+		peersDB.Node.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var claim joinClaim
+	err = json.Unmarshal(claimJSON, &claim)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyJoinClaim(&claim)
+	if err != nil {
+		return nil, err
+	}
+	return &claim, nil
+}
+
+// a write invite which was used to grant write access
+type redeemedInvite struct {
+	Identity string    `json:"identity"` // the orbitdb identity which was granted write access
+	Expires  time.Time `json:"expires"`  // when the invite expires, afterwards it is forgotten
+}
+
+// persisted ids of redeemed write invites, so a leaked token can't grant
+// write access to more than one identity
+type RedeemedInvites struct {
+	mtx      sync.Mutex
+	redeemed map[string]redeemedInvite
+}
+
+// the file the redeemed invites are persisted in
+func redeemedInvitesPath() string {
+	return *config.FlagRepo + "_invites"
+}
+
+// loads the persisted redeemed invites, an empty list is returned if there is
+// none
+func LoadRedeemedInvites() (*RedeemedInvites, error) {
+	ri := &RedeemedInvites{redeemed: make(map[string]redeemedInvite)}
+
+	data, err := ioutil.ReadFile(redeemedInvitesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ri, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &ri.redeemed)
+	if err != nil {
+		return nil, err
+	}
+	return ri, nil
+}
+
+// marks the invite as redeemed by the identity and persists it. Redeeming it
+// again for the same identity is fine, e.g. when a join request is repeated.
+func (ri *RedeemedInvites) Redeem(inv *Invite, identity string) error {
+	if inv.ID == "" {
+		return errors.New("invite has no id, it has to be reissued")
+	}
+
+	ri.mtx.Lock()
+	defer ri.mtx.Unlock()
+
+	r, ok := ri.redeemed[inv.ID]
+	if ok && r.Identity != identity {
+		return errors.New("invite " + inv.ID + " was redeemed already")
+	}
+	ri.redeemed[inv.ID] = redeemedInvite{identity, inv.Expires}
+
+	return ri.save()
+}
+
+// forgets a redeemed invite, used if granting failed
+func (ri *RedeemedInvites) Release(id string) {
+	ri.mtx.Lock()
+	defer ri.mtx.Unlock()
+	delete(ri.redeemed, id)
+	ri.save()
+}
+
+// persists the invites, expired ones can't be redeemed anyway so they are
+// dropped. Has to be called with the lock held.
+func (ri *RedeemedInvites) save() error {
+	for id, r := range ri.redeemed {
+		if time.Now().After(r.Expires) {
+			delete(ri.redeemed, id)
+		}
+	}
+	return config.SaveStructAsJSON(ri.redeemed, redeemedInvitesPath())
+}
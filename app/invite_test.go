@@ -0,0 +1,126 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// signs an invite like issueInvite does, with the given key
+func testToken(t *testing.T, key crypto.PrivKey, inv Invite) string {
+	t.Helper()
+
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv.Issuer = id.String()
+	inv.IssuerKey, err = crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invJSON, err := json.Marshal(inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := key.Sign(invJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenJSON, err := json.Marshal(signedInvite{invJSON, sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(tokenJSON)
+}
+
+func testKey(t *testing.T) crypto.PrivKey {
+	t.Helper()
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifyInvite(t *testing.T) {
+	inv := Invite{ID: "1", Role: writeRole, Expires: time.Now().Add(time.Hour)}
+	got, err := verifyInvite(testToken(t, testKey(t), inv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != inv.ID || got.Role != writeRole {
+		t.Fatalf("got invite %+v", got)
+	}
+}
+
+func TestVerifyInviteExpired(t *testing.T) {
+	inv := Invite{ID: "1", Role: writeRole, Expires: time.Now().Add(-time.Minute)}
+	_, err := verifyInvite(testToken(t, testKey(t), inv))
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected an expiry error, got %v", err)
+	}
+}
+
+func TestVerifyInviteForged(t *testing.T) {
+	inv := Invite{ID: "1", Role: readRole, Expires: time.Now().Add(time.Hour)}
+	token := testToken(t, testKey(t), inv)
+
+	tokenJSON, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signed signedInvite
+	err = json.Unmarshal(tokenJSON, &signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forge := func(signed signedInvite) string {
+		data, err := json.Marshal(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	// the role is raised after signing
+	var tampered Invite
+	json.Unmarshal(signed.Invite, &tampered)
+	tampered.Role = writeRole
+	tamperedJSON, _ := json.Marshal(tampered)
+	_, err = verifyInvite(forge(signedInvite{tamperedJSON, signed.Signature}))
+	if err == nil {
+		t.Fatal("accepted an invite changed after signing")
+	}
+
+	// another key signs in the issuer's name
+	other := testKey(t)
+	sig, err := other.Sign(signed.Invite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifyInvite(forge(signedInvite{signed.Invite, sig}))
+	if err == nil {
+		t.Fatal("accepted an invite signed by another key")
+	}
+
+	// the other key claims to be the issuer
+	tampered.Role = readRole
+	tampered.IssuerKey, _ = crypto.MarshalPublicKey(other.GetPublic())
+	tamperedJSON, _ = json.Marshal(tampered)
+	sig, err = other.Sign(tamperedJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifyInvite(forge(signedInvite{tamperedJSON, sig}))
+	if err == nil || !strings.Contains(err.Error(), "does not belong") {
+		t.Fatalf("expected an issuer mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"peersdb/config"
+	"sort"
+	"sync"
+	"time"
+
+	ipfslog "berty.tech/go-ipfs-log"
+	orbitdb "berty.tech/go-orbit-db"
+)
+
+// an identity which exceeded the contribution limit
+type Offender struct {
+	Identity     string    `json:"identity"`     // orbitdb identity which signed the entries
+	Contributors []string  `json:"contributors"` // declared contributors of the ignored entries
+	Ignored      int       `json:"ignored"`      // number of ignored contributions
+	LastSeen     time.Time `json:"lastSeen"`     // when the last ignored contribution arrived
+}
+
+// limits the contributions per identity and time window. Replicated
+// contributions above the limit are ignored, i.e. neither pinned nor
+// validated, and their identities are reported as offenders.
+//
+// Contributions are counted by their creation time, so the history a node
+// replicates for the first time or after being offline counts against the
+// windows it was created in. The creation time is only trusted if the
+// contributor signed it, and it has to be plausible : not in the future and
+// not older than the entries the contribution was appended to, both within
+// maxClockSkew. Otherwise the receive time is used or, for implausible signed
+// times, the contribution is ignored.
+type Moderation struct {
+	mtx       sync.Mutex
+	times     map[string][]time.Time // sorted creation times of the admitted contributions per identity
+	seen      map[string]bool        // entries which were counted already
+	ignored   map[string]bool        // entries of ignored contributions
+	offenders map[string]*Offender
+}
+
+// how far clocks of nodes may differ
+const maxClockSkew = 5 * time.Minute
+
+func NewModeration() *Moderation {
+	return &Moderation{
+		times:     make(map[string][]time.Time),
+		seen:      make(map[string]bool),
+		ignored:   make(map[string]bool),
+		offenders: make(map[string]*Offender),
+	}
+}
+
+// counts the contributions of the identity within the window ending at ts,
+// has to be called with the lock held
+func (m *Moderation) count(identity string, ts time.Time) int {
+	times := m.times[identity]
+	from := sort.Search(len(times), func(i int) bool {
+		return times[i].After(ts.Add(-*config.FlagContributionWindow))
+	})
+	to := sort.Search(len(times), func(i int) bool {
+		return times[i].After(ts)
+	})
+	return to - from
+}
+
+// remembers an admitted contribution, history arrives in any order so the
+// time is inserted at its place. Has to be called with the lock held.
+func (m *Moderation) record(identity string, ts time.Time) {
+	times := m.times[identity]
+	i := sort.Search(len(times), func(i int) bool {
+		return times[i].After(ts)
+	})
+	times = append(times, time.Time{})
+	copy(times[i+1:], times[i:])
+	times[i] = ts
+	m.times[identity] = times
+}
+
+// checks whether the identity may contribute right now, used for local posts
+func (m *Moderation) Check(identity string) error {
+	if *config.FlagContributionLimit <= 0 {
+		return nil
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.count(identity, time.Now()) >= *config.FlagContributionLimit {
+		return fmt.Errorf("contribution limit of %d per %s reached",
+			*config.FlagContributionLimit, *config.FlagContributionWindow)
+	}
+	return nil
+}
+
+// counts a local contribution
+func (m *Moderation) Record(entry string, identity string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.seen[entry] {
+		return
+	}
+	m.seen[entry] = true
+	m.record(identity, time.Now())
+}
+
+// counts a replicated contribution and returns whether it is within the
+// limit. verified tells whether the contributor signed the creation time,
+// notBefore is the newest creation time of the entries it was appended to.
+// Contributions above the limit or with an implausible creation time are
+// ignored and reported.
+func (m *Moderation) Admit(entry string, identity string, c Contribution, verified bool,
+	notBefore time.Time) bool {
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.seen[entry] {
+		return !m.ignored[entry]
+	}
+	m.seen[entry] = true
+
+	limit := *config.FlagContributionLimit
+	if limit <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	ts := now
+	admit := true
+	if verified {
+		ts = c.CreationTS
+		admit = !ts.After(now.Add(maxClockSkew)) && !ts.Before(notBefore.Add(-maxClockSkew))
+	}
+	if admit && m.count(identity, ts) < limit {
+		m.record(identity, ts)
+		return true
+	}
+
+	m.ignored[entry] = true
+	o, ok := m.offenders[identity]
+	if !ok {
+		o = &Offender{Identity: identity}
+		m.offenders[identity] = o
+	}
+	o.Ignored++
+	o.LastSeen = now
+	known := false
+	for _, contributor := range o.Contributors {
+		known = known || contributor == c.Contributor
+	}
+	if !known {
+		o.Contributors = append(o.Contributors, c.Contributor)
+	}
+
+	return false
+}
+
+// the newest creation time of the verified contributions an entry was
+// appended to. Parents which are no contributions or aren't loaded are
+// skipped.
+func newestParentTS(db orbitdb.EventLogStore, entry ipfslog.Entry) time.Time {
+	var newest time.Time
+	for _, next := range entry.GetNext() {
+		parent, ok := db.OpLog().Get(next)
+		if !ok {
+			continue
+		}
+
+		var op opDoc
+		if json.Unmarshal(parent.GetPayload(), &op) != nil {
+			continue
+		}
+		var c Contribution
+		if json.Unmarshal(op.Value, &c) != nil || c.Path == "" {
+			continue
+		}
+		if verifyContributor(c, parent.GetIdentity().ID) != nil {
+			continue
+		}
+
+		if c.CreationTS.After(newest) {
+			newest = c.CreationTS
+		}
+	}
+	return newest
+}
+
+// whether the contribution of an entry was ignored because of the limit. It's
+// keyed by entry, since anyone can post an existing path again.
+func (m *Moderation) IsIgnored(entry string) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.ignored[entry]
+}
+
+// returns the offenders, most ignored contributions first
+func (m *Moderation) Offenders() []Offender {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	offenders := make([]Offender, 0, len(m.offenders))
+	for _, o := range m.offenders {
+		offender := *o
+		offender.Contributors = append([]string(nil), o.Contributors...)
+		offenders = append(offenders, offender)
+	}
+	sort.Slice(offenders, func(i, j int) bool {
+		return offenders[i].Ignored > offenders[j].Ignored
+	})
+	return offenders
+}
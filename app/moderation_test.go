@@ -0,0 +1,102 @@
+package app
+
+import (
+	"fmt"
+	"peersdb/config"
+	"testing"
+	"time"
+)
+
+// sets the contribution limit for a test
+func withLimit(t *testing.T, limit int, window time.Duration) {
+	t.Helper()
+	oldLimit, oldWindow := *config.FlagContributionLimit, *config.FlagContributionWindow
+	*config.FlagContributionLimit, *config.FlagContributionWindow = limit, window
+	t.Cleanup(func() {
+		*config.FlagContributionLimit, *config.FlagContributionWindow = oldLimit, oldWindow
+	})
+}
+
+func TestAdmitWithinWindow(t *testing.T) {
+	withLimit(t, 2, time.Hour)
+	m := NewModeration()
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		c := Contribution{Contributor: "a", CreationTS: now}
+		if !m.Admit(fmt.Sprint(i), "id", c, true, time.Time{}) {
+			t.Fatalf("contribution %d was ignored", i)
+		}
+	}
+
+	c := Contribution{Contributor: "a", CreationTS: now}
+	if m.Admit("2", "id", c, true, time.Time{}) {
+		t.Fatal("admitted a contribution above the limit")
+	}
+	if !m.IsIgnored("2") || m.IsIgnored("0") {
+		t.Fatal("wrong entries are ignored")
+	}
+	if o := m.Offenders(); len(o) != 1 || o[0].Identity != "id" || o[0].Ignored != 1 {
+		t.Fatalf("got offenders %+v", o)
+	}
+
+	// another identity has its own limit
+	if !m.Admit("3", "other", c, true, time.Time{}) {
+		t.Fatal("the limit of one identity applies to another")
+	}
+}
+
+func TestAdmitHistory(t *testing.T) {
+	withLimit(t, 2, time.Hour)
+	m := NewModeration()
+
+	// a node replicating a store for the first time receives the history at
+	// once, it's counted in the windows it was created in
+	start := time.Now().Add(-24 * time.Hour)
+	for i := 0; i < 20; i++ {
+		c := Contribution{Contributor: "a", CreationTS: start.Add(time.Duration(i) * time.Hour)}
+		if !m.Admit(fmt.Sprint(i), "id", c, true, time.Time{}) {
+			t.Fatalf("historic contribution %d was ignored", i)
+		}
+	}
+	if len(m.Offenders()) != 0 {
+		t.Fatal("reported offenders for the history")
+	}
+}
+
+func TestAdmitImplausibleTime(t *testing.T) {
+	withLimit(t, 10, time.Hour)
+	m := NewModeration()
+	now := time.Now()
+
+	future := Contribution{Contributor: "a", CreationTS: now.Add(time.Hour)}
+	if m.Admit("future", "id", future, true, time.Time{}) {
+		t.Fatal("admitted a contribution from the future")
+	}
+
+	// backdated below the entries it was appended to
+	backdated := Contribution{Contributor: "a", CreationTS: now.Add(-48 * time.Hour)}
+	if m.Admit("backdated", "id", backdated, true, now) {
+		t.Fatal("admitted a backdated contribution")
+	}
+
+	// unsigned creation times are not trusted, the receive time counts
+	unverified := Contribution{Contributor: "a", CreationTS: now.Add(time.Hour)}
+	if !m.Admit("unverified", "id", unverified, false, now) {
+		t.Fatal("ignored an unverified contribution within the limit")
+	}
+}
+
+func TestAdmitSeenEntry(t *testing.T) {
+	withLimit(t, 1, time.Hour)
+	m := NewModeration()
+
+	c := Contribution{Contributor: "a", CreationTS: time.Now()}
+	if !m.Admit("0", "id", c, true, time.Time{}) {
+		t.Fatal("ignored the first contribution")
+	}
+	// replicated again, e.g. from another peer
+	if !m.Admit("0", "id", c, true, time.Time{}) {
+		t.Fatal("counted an entry twice")
+	}
+}
@@ -0,0 +1,353 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"peersdb/config"
+	"peersdb/ipfs"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/net/context"
+)
+
+// bounds of the exponential backoff between reconnection attempts
+const (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = 10 * time.Minute
+)
+
+// a peer we have successfully connected to before
+type KnownPeer struct {
+	ID       string    `json:"id"`
+	Addrs    []string  `json:"addrs"`    // full addresses including the peer id
+	LastSeen time.Time `json:"lastSeen"` // timestamp of the last successful connection
+}
+
+// persisted list of known peers, which we try to stay connected to
+type KnownPeers struct {
+	mtx   sync.Mutex
+	peers map[string]*KnownPeer
+
+	// peers for which a reconnect loop is running
+	reconnecting map[string]bool
+
+	// peers disconnected via command, they are neither reconnected nor dialed
+	// on discovery until they are connected to explicitly
+	disconnected map[string]bool
+}
+
+// the file the known peers are persisted in
+func knownPeersPath() string {
+	return *config.FlagRepo + "_peers"
+}
+
+// loads the persisted known peers, an empty list is returned if there is none
+func LoadKnownPeers() (*KnownPeers, error) {
+	kp := &KnownPeers{
+		peers:        make(map[string]*KnownPeer),
+		reconnecting: make(map[string]bool),
+		disconnected: make(map[string]bool),
+	}
+
+	data, err := ioutil.ReadFile(knownPeersPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return kp, nil
+		}
+		return nil, err
+	}
+
+	var peers []*KnownPeer
+	err = json.Unmarshal(data, &peers)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range peers {
+		kp.peers[p.ID] = p
+	}
+
+	return kp, nil
+}
+
+// returns all known peers sorted by id
+func (kp *KnownPeers) List() []KnownPeer {
+	kp.mtx.Lock()
+	defer kp.mtx.Unlock()
+	return kp.list()
+}
+
+func (kp *KnownPeers) list() []KnownPeer {
+	res := make([]KnownPeer, 0, len(kp.peers))
+	for _, p := range kp.peers {
+		res = append(res, *p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// adds or updates a peer and persists the list
+func (kp *KnownPeers) Add(id string, addrs []string) error {
+	kp.mtx.Lock()
+	defer kp.mtx.Unlock()
+
+	p, ok := kp.peers[id]
+	if !ok {
+		p = &KnownPeer{ID: id}
+		kp.peers[id] = p
+	}
+
+	// merge addresses
+	for _, a := range addrs {
+		known := false
+		for _, b := range p.Addrs {
+			known = known || a == b
+		}
+		if !known {
+			p.Addrs = append(p.Addrs, a)
+		}
+	}
+	p.LastSeen = time.Now()
+
+	return kp.save()
+}
+
+// removes a peer and persists the list
+func (kp *KnownPeers) Remove(id string) error {
+	kp.mtx.Lock()
+	defer kp.mtx.Unlock()
+
+	if _, ok := kp.peers[id]; !ok {
+		return errors.New("unknown peer " + id)
+	}
+	delete(kp.peers, id)
+
+	return kp.save()
+}
+
+// forgets a peer and keeps it from being dialed again until Undisconnect is
+// called for it
+func (kp *KnownPeers) Disconnect(id string) error {
+	kp.mtx.Lock()
+	defer kp.mtx.Unlock()
+
+	kp.disconnected[id] = true
+	delete(kp.peers, id)
+
+	return kp.save()
+}
+
+// allows dialing a peer again which was disconnected via command
+func (kp *KnownPeers) Undisconnect(id string) {
+	kp.mtx.Lock()
+	defer kp.mtx.Unlock()
+	delete(kp.disconnected, id)
+}
+
+// whether the peer was disconnected via command
+func (kp *KnownPeers) IsDisconnected(id string) bool {
+	kp.mtx.Lock()
+	defer kp.mtx.Unlock()
+	return kp.disconnected[id]
+}
+
+// returns the known addresses of a peer, or nil if the peer is unknown
+func (kp *KnownPeers) addrs(id string) []string {
+	kp.mtx.Lock()
+	defer kp.mtx.Unlock()
+
+	p, ok := kp.peers[id]
+	if !ok {
+		return nil
+	}
+	return append([]string{}, p.Addrs...)
+}
+
+func (kp *KnownPeers) save() error {
+	return config.SaveStructAsJSON(kp.list(), knownPeersPath())
+}
+
+// executes peers-add command, remembers the peer and connects to it
+func addPeer(peersDB *PeersDB, addr string, logChan chan Log) interface{} {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	info, err := peer.AddrInfoFromP2pAddr(maddr)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	peersDB.KnownPeers.Undisconnect(info.ID.String())
+	err = peersDB.KnownPeers.Add(info.ID.String(), []string{addr})
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	go reconnect(peersDB, info.ID, logChan)
+	return "Added peer " + info.ID.String()
+}
+
+// executes peers-remove command
+func removePeer(peersDB *PeersDB, id string, logChan chan Log) interface{} {
+	err := peersDB.KnownPeers.Remove(id)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	return "Removed peer " + id
+}
+
+// records the given peer as known, if we are connected to it. Peers which
+// were disconnected via command are not recorded.
+func recordPeer(peersDB *PeersDB, id peer.ID, addrs []string) error {
+	host := peersDB.Node.PeerHost
+	if host.Network().Connectedness(id) != network.Connected {
+		return errors.New("not connected to " + id.String())
+	}
+	if peersDB.KnownPeers.IsDisconnected(id.String()) {
+		return nil
+	}
+
+	return peersDB.KnownPeers.Add(id.String(), addrs)
+}
+
+// the addresses a connected peer can be dialed at, i.e. those of outbound
+// connections and those learned via identify. Addresses of inbound connections
+// are left out, their ports are usually ephemeral.
+func dialAddrs(h host.Host, id peer.ID) []string {
+	p2pAddr, err := ma.NewMultiaddr("/p2p/" + id.String())
+	if err != nil {
+		return nil
+	}
+
+	var maddrs []ma.Multiaddr
+	for _, conn := range h.Network().ConnsToPeer(id) {
+		if conn.Stat().Direction == network.DirOutbound {
+			maddrs = append(maddrs, conn.RemoteMultiaddr())
+		}
+	}
+	maddrs = append(maddrs, h.Peerstore().Addrs(id)...)
+
+	addrs := make([]string, 0, len(maddrs))
+	for _, a := range maddrs {
+		addrs = append(addrs, a.Encapsulate(p2pAddr).String())
+	}
+	return addrs
+}
+
+// connects to all known peers on startup, records every peer we get connected
+// to, inbound and discovered ones included, and reconnects whenever a known
+// peer disconnects
+func maintainKnownPeers(peersDB *PeersDB, logChan chan Log) {
+	host := peersDB.Node.PeerHost
+
+	// subscribe before connecting, so no disconnect goes unnoticed
+	sub, err := host.EventBus().Subscribe([]interface{}{
+		new(event.EvtPeerConnectednessChanged),
+		new(event.EvtPeerIdentificationCompleted),
+	})
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return
+	}
+	defer sub.Close()
+
+	for _, p := range peersDB.KnownPeers.List() {
+		id, err := peer.Decode(p.ID)
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+			continue
+		}
+		go reconnect(peersDB, id, logChan)
+	}
+
+	for e := range sub.Out() {
+		switch e := e.(type) {
+		case event.EvtPeerConnectednessChanged:
+			if e.Connectedness == network.Connected {
+				err := recordPeer(peersDB, e.Peer, dialAddrs(host, e.Peer))
+				if err != nil {
+					logChan <- Log{Type: RecoverableErr, Data: err}
+				}
+				continue
+			}
+			if e.Connectedness == network.NotConnected &&
+				peersDB.KnownPeers.addrs(e.Peer.String()) != nil {
+				go reconnect(peersDB, e.Peer, logChan)
+			}
+
+		// identify tells us the peer's listen addresses
+		case event.EvtPeerIdentificationCompleted:
+			if host.Network().Connectedness(e.Peer) == network.Connected {
+				err := recordPeer(peersDB, e.Peer, dialAddrs(host, e.Peer))
+				if err != nil {
+					logChan <- Log{Type: RecoverableErr, Data: err}
+				}
+			}
+		}
+	}
+}
+
+// tries to connect to a known peer with exponential backoff until it succeeds
+// or the peer has been removed
+func reconnect(peersDB *PeersDB, id peer.ID, logChan chan Log) {
+	kp := peersDB.KnownPeers
+
+	// only one loop per peer
+	kp.mtx.Lock()
+	if kp.reconnecting[id.String()] {
+		kp.mtx.Unlock()
+		return
+	}
+	kp.reconnecting[id.String()] = true
+	kp.mtx.Unlock()
+
+	defer func() {
+		kp.mtx.Lock()
+		delete(kp.reconnecting, id.String())
+		kp.mtx.Unlock()
+	}()
+
+	host := peersDB.Node.PeerHost
+	backoff := reconnectMinBackoff
+	for {
+		addrs := kp.addrs(id.String())
+		if addrs == nil || kp.IsDisconnected(id.String()) {
+			return
+		}
+
+		if host.Network().Connectedness(id) == network.Connected {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := ipfs.ConnectToPeers(ctx, peersDB.Orbit, addrs)
+		cancel()
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+		}
+
+		if recordPeer(peersDB, id, nil) == nil {
+			logChan <- Log{Info, "Reconnected to " + id.String()}
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
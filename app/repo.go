@@ -0,0 +1,245 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"berty.tech/go-orbit-db/iface"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+	"github.com/ipfs/kubo/core/corerepo"
+	"github.com/ipfs/kubo/gc"
+	"golang.org/x/net/context"
+)
+
+// result of a garbage collection run
+type GCResult struct {
+	RemovedBlocks  uint64 `json:"removedBlocks"`
+	ReclaimedBytes uint64 `json:"reclaimedBytes"`
+}
+
+// storage statistics of the ipfs repo
+type RepoStats struct {
+	RepoSize    uint64 `json:"repoSize"`    // size in bytes
+	StorageMax  uint64 `json:"storageMax"`  // size in bytes
+	NumBlocks   uint64 `json:"numBlocks"`   // number of blocks in the blockstore
+	PinnedBytes uint64 `json:"pinnedBytes"` // size of all pinned dags
+	RepoPath    string `json:"repoPath"`
+}
+
+// executes gc command, removes all blocks from the blockstore which are neither
+// pinned, part of one of our stores, a snapshot nor data of our own
+// contributions
+func collectGarbage(peersDB *PeersDB, logChan chan Log) interface{} {
+	ctx := context.Background()
+	node := peersDB.Node
+
+	roots, err := gcRoots(ctx, peersDB)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	before, err := node.Repo.GetStorageUsage(ctx)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	var res GCResult
+	gcOut := gc.GC(ctx, node.Blockstore, node.Repo.Datastore(), node.Pinning, roots)
+	for r := range gcOut {
+		if r.Error != nil {
+			logChan <- Log{Type: RecoverableErr, Data: r.Error}
+			continue
+		}
+		res.RemovedBlocks++
+	}
+
+	after, err := node.Repo.GetStorageUsage(ctx)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+	if before > after {
+		res.ReclaimedBytes = before - after
+	}
+
+	logChan <- Log{Info, fmt.Sprintf("gc removed %d blocks", res.RemovedBlocks)}
+	return res
+}
+
+// collects the roots which have to survive a gc run next to the pinned data
+func gcRoots(ctx context.Context, peersDB *PeersDB) ([]cid.Cid, error) {
+	// keep whatever kubo keeps by default (mfs)
+	roots, err := corerepo.BestEffortRoots(peersDB.Node.FilesRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// the manifest behind a store address is needed to open the store again,
+	// the oplog heads link to all previous entries, so keeping them keeps the
+	// whole log
+	var stores []iface.Store
+	if peersDB.Contributions != nil {
+		stores = append(stores, *peersDB.Contributions)
+	}
+	if peersDB.Validations != nil {
+		stores = append(stores, *peersDB.Validations)
+	}
+	if peersDB.Annotations != nil {
+		stores = append(stores, *peersDB.Annotations)
+	}
+	for _, s := range stores {
+		roots = append(roots, s.Address().GetRoot())
+		for _, head := range s.OpLog().Heads().Slice() {
+			roots = append(roots, head.GetHash())
+		}
+	}
+
+	// orbitdb doesn't expose the stores it opens itself, e.g. the keyvalue
+	// log of the orbitdb access controller which holds the grants. Manifests
+	// and log entries are dag-cbor, so all dag-cbor blocks are kept.
+	keys, err := peersDB.Node.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for c := range keys {
+		if c.Prefix().Codec == cid.DagCBOR {
+			roots = append(roots, c)
+		}
+	}
+
+	if peersDB.Contributions == nil {
+		return roots, nil
+	}
+
+	// our own contributions might not be pinned, but we may be the only ones
+	// holding the data
+	state, err := materialize(ctx, peersDB)
+	if err != nil {
+		return nil, err
+	}
+
+	coreAPI := (*peersDB.Orbit).IPFS()
+
+	// snapshots of other nodes aren't pinned, but they are needed to load the
+	// state without replaying the whole log
+	for _, entry := range (*peersDB.Contributions).OpLog().Values().Slice() {
+		var op opDoc
+		if json.Unmarshal(entry.GetPayload(), &op) != nil || !isSnapshotRef(op.Value) {
+			continue
+		}
+		var ref SnapshotRef
+		if json.Unmarshal(op.Value, &ref) != nil {
+			continue
+		}
+
+		resolved, err := coreAPI.ResolvePath(ctx, path.New(ref.Snapshot))
+		if err != nil {
+			continue
+		}
+		roots = append(roots, resolved.Cid())
+	}
+
+	ownID := (*peersDB.Contributions).Identity().ID
+	for _, r := range state.Records {
+		if r.Retracted || r.Signer != ownID {
+			continue
+		}
+
+		resolved, err := coreAPI.ResolvePath(ctx, path.New(r.Contribution.Path))
+		if err != nil {
+			continue
+		}
+		roots = append(roots, resolved.Cid())
+	}
+
+	return roots, nil
+}
+
+// executes repo command
+func repo(peersDB *PeersDB, subCmd string, logChan chan Log) interface{} {
+	switch subCmd {
+	case "stats":
+		return repoStats(peersDB, logChan)
+	default:
+		err := errors.New("unknown repo command " + subCmd + ", try stats")
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+}
+
+// gathers storage statistics of the ipfs repo
+func repoStats(peersDB *PeersDB, logChan chan Log) interface{} {
+	ctx := context.Background()
+
+	stat, err := corerepo.RepoStat(ctx, peersDB.Node)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	pinned, err := pinnedBytes(ctx, peersDB)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	return RepoStats{
+		RepoSize:    stat.RepoSize,
+		StorageMax:  stat.StorageMax,
+		NumBlocks:   stat.NumObjects,
+		PinnedBytes: pinned,
+		RepoPath:    stat.RepoPath,
+	}
+}
+
+// sums up the size of all pinned blocks, blocks referenced by multiple pins
+// are only counted once
+func pinnedBytes(ctx context.Context, peersDB *PeersDB) (uint64, error) {
+	coreAPI := (*peersDB.Orbit).IPFS()
+	pins, err := coreAPI.Pin().Ls(ctx, options.Pin.Ls.All())
+	if err != nil {
+		return 0, err
+	}
+
+	var size uint64
+	count := func(n ipld.Node) error {
+		size += uint64(len(n.RawData()))
+		return nil
+	}
+
+	visited := make(map[cid.Cid]bool)
+	for p := range pins {
+		if p.Err() != nil {
+			return 0, p.Err()
+		}
+
+		root := p.Path().Cid()
+		switch p.Type() {
+		case "recursive":
+			err = walkDAG(ctx, peersDB, root, visited, count)
+		case "direct":
+			if visited[root] {
+				continue
+			}
+			visited[root] = true
+
+			var stat coreiface.BlockStat
+			stat, err = coreAPI.Block().Stat(ctx, p.Path())
+			if err == nil {
+				size += uint64(stat.Size())
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return size, nil
+}
@@ -4,22 +4,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os/user"
-	"path/filepath"
+	"io/ioutil"
 	"peersdb/config"
 	"peersdb/ipfs"
 	"strings"
+	"sync"
 	"time"
 
 	orbitdb "berty.tech/go-orbit-db"
-	"berty.tech/go-orbit-db/accesscontroller"
 	"berty.tech/go-orbit-db/iface"
 	"berty.tech/go-orbit-db/stores"
 	files "github.com/ipfs/go-ipfs-files"
 	"github.com/ipfs/interface-go-ipfs-core/options"
 	"github.com/ipfs/interface-go-ipfs-core/path"
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
 	"golang.org/x/net/context"
 )
 
@@ -30,19 +32,67 @@ type Method struct {
 }
 
 var (
-	GET       Method = Method{"get", 1}     // needs the ipfs filepath
-	POST      Method = Method{"post", 1}    // needs a string of bytes representing the file
-	CONNECT   Method = Method{"connect", 1} // needs the peer address
-	QUERY     Method = Method{"query", 0}
-	BENCHMARK Method = Method{"benchmark", 0}
+	GET         Method = Method{"get", 1}            // needs the ipfs filepath
+	POST        Method = Method{"post", 1}           // needs a string of bytes representing the file
+	POSTENC     Method = Method{"post-encrypted", 1} // needs a string of bytes representing the file
+	CONNECT     Method = Method{"connect", 1}        // needs the peer address
+	QUERY       Method = Method{"query", 0}
+	QUERYALL    Method = Method{"query-all", 0} // includes retracted contributions
+	BENCHMARK   Method = Method{"benchmark", 0}
+	RETRACT     Method = Method{"retract", 1} // needs the ipfs path of the contribution
+	EXPORT      Method = Method{"export", 2}  // needs the destination file and a filter ("*" or comma separated ipfs paths)
+	IMPORT      Method = Method{"import", 1}  // needs the archive file
+	GC          Method = Method{"gc", 0}
+	REPO        Method = Method{"repo", 1}         // needs the sub command, e.g. "stats"
+	ANNOTATE    Method = Method{"annotate", 3}     // needs the ipfs path, the field (rating, note or recommended) and its value
+	ANNOTATIONS Method = Method{"annotations", 1}  // needs the ipfs path
+	PEERSADD    Method = Method{"peers-add", 1}    // needs the peer address
+	PEERSREMOVE Method = Method{"peers-remove", 1} // needs the peer id
+	PEERSLIST   Method = Method{"peers-list", 0}
+	PEERS       Method = Method{"peers", 0} // lists the peer directory
+	STATUS      Method = Method{"status", 0}
+	DISCONNECT  Method = Method{"disconnect", 1} // needs the peer id
+	BLOCK       Method = Method{"block", 1}      // needs the peer id or orbitdb identity
+	UNBLOCK     Method = Method{"unblock", 1}    // needs the peer id or orbitdb identity
+	BLOCKLIST   Method = Method{"blocklist", 0}
+	BANDWIDTH   Method = Method{"bandwidth", 0}
+	GRANT       Method = Method{"grant", 2}  // needs the capability (write or admin) and the orbitdb identity
+	REVOKE      Method = Method{"revoke", 2} // needs the capability (write or admin) and the orbitdb identity
+	WRITERS     Method = Method{"writers", 0}
+	INVITE      Method = Method{"invite", 2} // needs the role (read or write) and how long the token is valid, e.g. 24h
+	JOIN        Method = Method{"join", 1}   // needs the invite token
+	MODERATION  Method = Method{"moderation", 0}
+	AUDIT       Method = Method{"audit", 1}           // needs the number of entries
+	IDEXPORT    Method = Method{"identity-export", 1} // needs the destination file
+	IDIMPORT    Method = Method{"identity-import", 1} // needs the exported identity file
+	IDROTATE    Method = Method{"identity-rotate", 1} // needs the key type, ed25519 or rsa
 )
 
+// all methods, the apis look them up by their command
+var methods = []Method{
+	GET, POST, POSTENC, CONNECT, QUERY, QUERYALL, BENCHMARK, RETRACT, EXPORT, IMPORT, GC,
+	REPO, ANNOTATE, ANNOTATIONS, PEERSADD, PEERSREMOVE, PEERSLIST, PEERS, STATUS, DISCONNECT,
+	BLOCK, UNBLOCK, BLOCKLIST, BANDWIDTH, GRANT, REVOKE, WRITERS, INVITE, JOIN, MODERATION,
+	AUDIT, IDEXPORT, IDIMPORT, IDROTATE,
+}
+
+// returns the method of a command, false if there is none
+func MethodByCmd(cmd string) (Method, bool) {
+	for _, m := range methods {
+		if m.Cmd == cmd {
+			return m, true
+		}
+	}
+	return Method{}, false
+}
+
 // Requests are an abstraction for the communication between this applications
 // various apis (shell, http, grpc etc.) and the actual db service
 // (n to 1 relation at the moment)
 type Request struct {
 	Method Method   `json:"method"`
 	Args   []string `json:"args"`
+	Caller string   `json:"-"` // who sent the request, for the audit log
 }
 
 // starts all reoccuring tasks on peersdb level
@@ -51,11 +101,17 @@ func Service(peersDB *PeersDB,
 	resChan chan interface{},
 	logChan chan Log) {
 
+	// reject malformed messages on our topics before they reach the handlers
+	err := registerValidators(peersDB, logChan)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+	}
+
 	// wait for and handle connectedness changed event
 	go awaitConnected(peersDB, logChan)
 
 	// wait for pubsub messages to self which will be received when another peer
-	// connects (see "awaitConnected" above)
+	// connects, if it shares its store (see "awaitConnected" above)
 	go awaitStoreExchange(peersDB, logChan)
 
 	// wait for write events to handle validation
@@ -67,6 +123,34 @@ func Service(peersDB *PeersDB,
 	// wait for and handle replication event
 	go awaitReplicateEvent(peersDB, logChan)
 
+	// compact the contributions eventlog from time to time
+	go snapshotPeriodically(peersDB, logChan)
+
+	// stay connected to known peers
+	go maintainKnownPeers(peersDB, logChan)
+
+	// find other peers of our contributions store via the dht
+	go discoverStorePeers(peersDB, logChan)
+
+	// keep the connections to peers of our contributions store
+	go protectStorePeers(peersDB, logChan)
+
+	// tell other nodes we are alive and keep track of theirs
+	go sendHeartbeats(peersDB, logChan)
+	go awaitHeartbeats(peersDB, logChan)
+
+	// grant write access to invited nodes
+	go awaitJoinRequests(peersDB, logChan)
+
+	// keep track of whether we are reachable from the outside
+	go trackReachability(peersDB, logChan)
+
+	// forget the traffic of peers which are gone
+	go pruneBandwidth(peersDB, logChan)
+
+	// record all store writes
+	auditStores(peersDB, logChan)
+
 	//--------------------------------------------------------------------------
 	// handle API requests
 
@@ -85,7 +169,12 @@ func Service(peersDB *PeersDB,
 		case POST.Cmd:
 			file := req.Args[0]
 			node := files.NewBytesFile([]byte(file))
-			res = post(peersDB, node, logChan)
+			res = post(peersDB, node, *config.FlagEncrypt, logChan)
+
+		case POSTENC.Cmd:
+			file := req.Args[0]
+			node := files.NewBytesFile([]byte(file))
+			res = post(peersDB, node, true, logChan)
 
 		case CONNECT.Cmd:
 			// type checking
@@ -94,7 +183,116 @@ func Service(peersDB *PeersDB,
 			res = connect(peersDB, peerId, logChan)
 
 		case QUERY.Cmd:
-			res = query(peersDB, logChan)
+			res = query(peersDB, false, logChan)
+
+		case QUERYALL.Cmd:
+			res = query(peersDB, true, logChan)
+
+		case RETRACT.Cmd:
+			ipfsPath := req.Args[0]
+			res = retract(peersDB, ipfsPath, logChan)
+
+		case EXPORT.Cmd:
+			dest := req.Args[0]
+			filter := req.Args[1]
+			res = export(peersDB, dest, filter, logChan)
+
+		case IMPORT.Cmd:
+			src := req.Args[0]
+			res = importArchive(peersDB, src, logChan)
+
+		case GC.Cmd:
+			res = collectGarbage(peersDB, logChan)
+
+		case REPO.Cmd:
+			subCmd := req.Args[0]
+			res = repo(peersDB, subCmd, logChan)
+
+		case ANNOTATE.Cmd:
+			ipfsPath := req.Args[0]
+			field := req.Args[1]
+			value := req.Args[2]
+			res = annotate(peersDB, ipfsPath, field, value, logChan)
+
+		case ANNOTATIONS.Cmd:
+			ipfsPath := req.Args[0]
+			res = annotations(peersDB, ipfsPath, logChan)
+
+		case PEERSADD.Cmd:
+			addr := req.Args[0]
+			res = addPeer(peersDB, addr, logChan)
+
+		case PEERSREMOVE.Cmd:
+			id := req.Args[0]
+			res = removePeer(peersDB, id, logChan)
+
+		case PEERSLIST.Cmd:
+			res = peersDB.KnownPeers.List()
+
+		case PEERS.Cmd:
+			res = peersDB.Directory.List()
+
+		case DISCONNECT.Cmd:
+			id := req.Args[0]
+			res = disconnect(peersDB, id, logChan)
+
+		case BLOCK.Cmd:
+			id := req.Args[0]
+			res = block(peersDB, id, logChan)
+
+		case UNBLOCK.Cmd:
+			id := req.Args[0]
+			res = unblock(peersDB, id, logChan)
+
+		case BLOCKLIST.Cmd:
+			res = peersDB.Blocklist.List()
+
+		case BANDWIDTH.Cmd:
+			res = bandwidth(peersDB)
+
+		case GRANT.Cmd:
+			capability := req.Args[0]
+			identity := req.Args[1]
+			res = grant(peersDB, capability, identity, logChan)
+
+		case REVOKE.Cmd:
+			capability := req.Args[0]
+			identity := req.Args[1]
+			res = revoke(peersDB, capability, identity, logChan)
+
+		case WRITERS.Cmd:
+			res = writers(peersDB, logChan)
+
+		case INVITE.Cmd:
+			role := req.Args[0]
+			validity := req.Args[1]
+			res = invite(peersDB, role, validity, logChan)
+
+		case JOIN.Cmd:
+			token := req.Args[0]
+			res = join(peersDB, token, logChan)
+
+		case MODERATION.Cmd:
+			res = peersDB.Moderation.Offenders()
+
+		case AUDIT.Cmd:
+			limit := req.Args[0]
+			res = audit(peersDB, limit, logChan)
+
+		case IDEXPORT.Cmd:
+			dest := req.Args[0]
+			res = exportIdentity(peersDB, dest, logChan)
+
+		case IDIMPORT.Cmd:
+			src := req.Args[0]
+			res = importIdentity(peersDB, src, logChan)
+
+		case IDROTATE.Cmd:
+			keyType := req.Args[0]
+			res = rotateIdentity(peersDB, keyType, logChan)
+
+		case STATUS.Cmd:
+			res = status(peersDB)
 
 		case BENCHMARK.Cmd:
 			if !*config.FlagBenchmark {
@@ -106,12 +304,19 @@ func Service(peersDB *PeersDB,
 		}
 
 		// send response
+		auditRequest(peersDB, req, res, logChan)
 		resChan <- res
 	}
 }
 
-// waits for connectedness changed events and on success sends the stores id
+// waits for connectedness changed events and on success sends the stores id.
+// That's only done with -share-store, otherwise the store address is handed out
+// via invite tokens.
 func awaitConnected(peersDB *PeersDB, logChan chan Log) {
+	if !*config.FlagShareStore {
+		return
+	}
+
 	// subscribe to ipfs level connectedness changed event
 	subipfs, err := (*peersDB.Node).PeerHost.EventBus().Subscribe(
 		new(event.EvtPeerConnectednessChanged))
@@ -121,33 +326,73 @@ func awaitConnected(peersDB *PeersDB, logChan chan Log) {
 	}
 
 	db := peersDB.Contributions
-	coreAPI := (*peersDB.Orbit).IPFS()
+
+	// peers which are only connected via relay get the store once a direct
+	// connection appears, e.g. after hole punching succeeded
+	var pending sync.Map
+	peersDB.Node.PeerHost.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			if c.Stat().Transient {
+				return
+			}
+			if _, ok := pending.LoadAndDelete(c.RemotePeer()); ok {
+				go sendStore(peersDB, db, c.RemotePeer(), logChan)
+			}
+		},
+	})
 
 	for e := range subipfs.Out() {
 		e, ok := e.(event.EvtPeerConnectednessChanged)
 		fmt.Print("\nConnectedness : ", e)
 
+		if ok && e.Connectedness == network.NotConnected {
+			pending.Delete(e.Peer)
+		}
+
 		// on established connection
 		go func() {
 			if ok && e.Connectedness == network.Connected && db != nil {
 				// TODO : can we await some event that the peer is ready
 				time.Sleep(time.Second * 5)
 
-				// send this stores id to peer by publishing it to the topic
-				// identified by their id
-				cidDbId := (*db).Address().String()
-				logChan <- Log{Info, "Send contributions db " + cidDbId + " to peer for replication"}
-				peerId := e.Peer.String()
-				ctx := context.Background()
-				err := coreAPI.PubSub().Publish(ctx, peerId, []byte(cidDbId))
-				if err != nil {
-					logChan <- Log{Type: RecoverableErr, Data: err}
+				// peers behind NAT may only be connected via relay until hole
+				// punching succeeded
+				if !awaitDirectConn(peersDB, e.Peer, time.Minute) {
+					if peersDB.Node.PeerHost.Network().Connectedness(e.Peer) != network.Connected {
+						return
+					}
+					logChan <- Log{Info, "No direct connection to " + e.Peer.String() +
+						" yet, sending the store once there is one"}
+					pending.Store(e.Peer, true)
+
+					// the direct connection may have appeared in between
+					if !awaitDirectConn(peersDB, e.Peer, 0) {
+						return
+					}
+					if _, ok := pending.LoadAndDelete(e.Peer); !ok {
+						return
+					}
 				}
+
+				sendStore(peersDB, db, e.Peer, logChan)
 			}
 		}()
 	}
 }
 
+// sends this stores id to the peer by publishing it to the topic identified by
+// their id
+func sendStore(peersDB *PeersDB, db *orbitdb.EventLogStore, p peer.ID, logChan chan Log) {
+	coreAPI := (*peersDB.Orbit).IPFS()
+	cidDbId := (*db).Address().String()
+	logChan <- Log{Info, "Send contributions db " + cidDbId + " to peer for replication"}
+	ctx := context.Background()
+	err := coreAPI.PubSub().Publish(ctx, p.String(), []byte(cidDbId))
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+	}
+}
+
 // on connectedness changed events, peers exchange their event logs
 func awaitStoreExchange(peersDB *PeersDB, logChan chan Log) {
 	// subscribe to own topic
@@ -169,45 +414,64 @@ func awaitStoreExchange(peersDB *PeersDB, logChan chan Log) {
 			logChan <- Log{Type: NonRecoverableErr, Data: err}
 			return
 		}
+		if peersDB.Blocklist.IsBlocked(msg.From().String()) {
+			continue
+		}
 
 		// in case we started without any db, replicate this one
 		if peersDB.Contributions == nil {
 			addr := string(msg.Data())
 			logChan <- Log{Info, "Replicate db " + addr}
-			create := false
-			storeType := "eventlog"
-
-			// give anyone write access
-			ac := &accesscontroller.CreateAccessControllerOptions{
-				Access: map[string][]string{
-					"write": {
-						"*",
-					},
-				},
-			}
-
-			dbopts := orbitdb.CreateDBOptions{
-				AccessController: ac,
-				Create:           &create,
-				StoreType:        &storeType,
-			}
-
-			store, err := (*peersDB.Orbit).Open(ctx, addr, &dbopts)
+			err = replicateStore(ctx, peersDB, addr)
 			if err != nil {
 				logChan <- Log{Type: RecoverableErr, Data: err}
 			}
+		}
+	}
+}
 
-			db := store.(iface.EventLogStore)
-			db.Load(ctx, -1)
-			peersDB.Contributions = &db
+// opens an existing contributions store by its address and replicates it
+func replicateStore(ctx context.Context, peersDB *PeersDB, addr string) error {
+	peersDB.ReplicateMtx.Lock()
+	defer peersDB.ReplicateMtx.Unlock()
 
-			// persist store address
-			peersDB.Config.ContributionsStoreAddr = addr
-		}
+	if peersDB.Contributions != nil {
+		return errors.New("there already is a contributions store")
+	}
+
+	create := false
+	storeType := "eventlog"
+
+	// the access controller is taken from the store's manifest
+	dbopts := orbitdb.CreateDBOptions{
+		Create:    &create,
+		StoreType: &storeType,
+	}
+
+	store, err := (*peersDB.Orbit).Open(ctx, addr, &dbopts)
+	if err != nil {
+		return err
 	}
+
+	db, ok := store.(iface.EventLogStore)
+	if !ok {
+		return errors.New(addr + " is not an eventlog")
+	}
+	err = loadContributions(ctx, peersDB, db)
+	if err != nil {
+		return err
+	}
+	peersDB.Contributions = &db
+
+	// persist store address
+	peersDB.Config.ContributionsStoreAddr = addr
+
+	// the annotations belong to the contributions
+	return openAnnotations(ctx, peersDB)
 }
 
 type opDoc struct {
+	Op    string `json:"op,omitempty"`
 	Key   string `json:"key,omitempty"`
 	Value []byte `json:"value,omitempty"`
 }
@@ -267,6 +531,11 @@ func awaitWriteEvent(peersDB *PeersDB, logChan chan Log) {
 			continue
 		}
 
+		// tombstones and snapshot references carry no data to validate
+		if isTombstone(op.Value) || isSnapshotRef(op.Value) {
+			continue
+		}
+
 		// get the ipfs file path the from the contribution block
 		var contribution Contribution
 		err = json.Unmarshal(op.Value, &contribution)
@@ -317,14 +586,26 @@ func validateStub(file files.Node) (bool, error) {
 }
 
 type Contribution struct {
-	Path        string    `json:"path"`        // ipfs file path which includes the cid
-	Contributor string    `json:"contributor"` // ipfs node id
-	CreationTS  time.Time `json:"creationTS"`  // timestamp of creation
+	Path        string      `json:"path"`                 // ipfs file path which includes the cid
+	Contributor string      `json:"contributor"`          // ipfs node id
+	CreationTS  time.Time   `json:"creationTS"`           // timestamp of creation
+	Encryption  *Encryption `json:"encryption,omitempty"` // set if the file is encrypted
+
+	// binds the contributor's peer id to the orbitdb identity signing the
+	// entry, see signContribution
+	ContributorKey []byte `json:"contributorKey,omitempty"` // libp2p public key of the contributor
+	Signature      []byte `json:"signature,omitempty"`
+}
+
+// a contribution as returned by the query command, merged with its annotations
+type QueryResult struct {
+	Contribution
+	Annotations    []Annotation `json:"annotations,omitempty"`
+	VerifiedAuthor string       `json:"verifiedAuthor"` // the contributor if the claim could be verified, empty otherwise
 }
 
 func get(peersDB *PeersDB, ipfsPath string, logChan chan Log) interface{} {
-	db := *peersDB.Contributions
-	coreAPI := db.IPFS()
+	coreAPI := (*peersDB.Orbit).IPFS()
 	ctx := context.Background()
 
 	pth := path.New(ipfsPath)
@@ -334,19 +615,27 @@ func get(peersDB *PeersDB, ipfsPath string, logChan chan Log) interface{} {
 		return nil
 	}
 
+	// encrypted contributions are decrypted before they are stored
+	enc, err := contributionEncryption(ctx, peersDB, ipfsPath)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return err
+	}
+	if enc != nil {
+		n, err = decryptNode(peersDB, n, enc)
+		if err != nil {
+			logChan <- Log{RecoverableErr, err}
+			return err
+		}
+	}
+
 	// determine destination location
 	// TODO : can we get the file info/name from the node ?
 	// otherwise add it to contribution block metadata
 	fileName := strings.TrimPrefix(ipfsPath, "/ipfs/")
-	dest := *config.FlagDownloadDir + fileName
-	if dest[:2] == "~/" {
-		// expand the tilde (~) notation to the user's home directory
-		usr, err := user.Current()
-		if err != nil {
-			return err
-		}
-		dir := usr.HomeDir
-		dest = filepath.Join(dir, dest[2:])
+	dest, err := expandHome(*config.FlagDownloadDir + fileName)
+	if err != nil {
+		return err
 	}
 
 	if err := files.WriteTo(n, dest); err != nil {
@@ -357,8 +646,104 @@ func get(peersDB *PeersDB, ipfsPath string, logChan chan Log) interface{} {
 	return "stored " + ipfsPath + " successfully under " + dest
 }
 
-// executes post command
-func post(peersDB *PeersDB, node files.Node, logChan chan Log) interface{} {
+// returns how the contribution with the given path is encrypted, nil if it
+// isn't encrypted or not a known contribution
+func contributionEncryption(ctx context.Context, peersDB *PeersDB, ipfsPath string) (*Encryption, error) {
+	if peersDB.Contributions == nil {
+		return nil, nil
+	}
+
+	state, err := materialize(ctx, peersDB)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range state.Records {
+		if r.Contribution.Path == ipfsPath && r.Contribution.Encryption != nil {
+			return r.Contribution.Encryption, nil
+		}
+	}
+	return nil, nil
+}
+
+// decrypts a file with the key shared with this node
+func decryptNode(peersDB *PeersDB, node files.Node, enc *Encryption) (files.Node, error) {
+	file, ok := node.(files.File)
+	if !ok {
+		return nil, errors.New("encrypted contributions have to be single files")
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// contributions from before an identity rotation were encrypted for one of
+	// our former keys
+	if _, ok := enc.Keys[peersDB.Config.PeerID]; !ok {
+		retired, err := ipfs.RetiredKeys()
+		if err != nil {
+			return nil, err
+		}
+		for id, key := range retired {
+			if _, ok := enc.Keys[id]; ok {
+				data, err = decrypt(data, enc, id, key)
+				if err != nil {
+					return nil, err
+				}
+				return files.NewBytesFile(data), nil
+			}
+		}
+	}
+
+	data, err = decrypt(data, enc, peersDB.Config.PeerID, peersDB.Node.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return files.NewBytesFile(data), nil
+}
+
+// encrypts a file for this node and the configured members
+func encryptNode(peersDB *PeersDB, node files.Node) (files.Node, *Encryption, error) {
+	file, ok := node.(files.File)
+	if !ok {
+		return nil, nil, errors.New("only single files can be encrypted")
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recipients := []string{peersDB.Config.PeerID}
+	for _, m := range peersDB.Config.Members {
+		if m != peersDB.Config.PeerID {
+			recipients = append(recipients, m)
+		}
+	}
+
+	data, enc, err := encrypt(data, recipients, func(id peer.ID) (crypto.PubKey, error) {
+		if id == peersDB.Node.Identity {
+			return peersDB.Node.PrivateKey.GetPublic(), nil
+		}
+
+		// ed25519 keys are part of the peer id, rsa keys are learned on
+		// connect
+		pub, err := id.ExtractPublicKey()
+		if err == nil {
+			return pub, nil
+		}
+		pub = peersDB.Node.PeerHost.Peerstore().PubKey(id)
+		if pub == nil {
+			return nil, errors.New("the key of member " + id.String() + " is unknown, connect to it once")
+		}
+		return pub, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return files.NewBytesFile(data), enc, nil
+}
+
+// executes post and post-encrypted command
+func post(peersDB *PeersDB, node files.Node, encrypted bool, logChan chan Log) interface{} {
 	ctx := context.Background()
 	coreAPI := (*peersDB.Orbit).IPFS()
 
@@ -370,6 +755,24 @@ func post(peersDB *PeersDB, node files.Node, logChan chan Log) interface{} {
 		return err
 	}
 
+	// spam protection, the same limit applies to everyone
+	ownID := (*peersDB.Orbit).Identity().ID
+	err := peersDB.Moderation.Check(ownID)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	// only members can read encrypted contributions
+	var enc *Encryption
+	if encrypted {
+		node, enc, err = encryptNode(peersDB, node)
+		if err != nil {
+			logChan <- Log{Type: RecoverableErr, Data: err}
+			return err
+		}
+	}
+
 	// store node in ipfs' blockstore as merkleDag and get it's key (= path)
 	filePath, err := coreAPI.Unixfs().Add(ctx, node)
 	if err != nil {
@@ -377,10 +780,21 @@ func post(peersDB *PeersDB, node files.Node, logChan chan Log) interface{} {
 		return err
 	}
 
-	// create the contribution block
+	// create the contribution block, adding pins the file
 	ipfsPath := filePath.String()
+	auditPinChange(peersDB, auditPin, ipfsPath, logChan)
 	ts := time.Now()
-	data := Contribution{ipfsPath, peersDB.Config.PeerID, ts}
+	data := Contribution{
+		Path:        ipfsPath,
+		Contributor: peersDB.Config.PeerID,
+		CreationTS:  ts,
+		Encryption:  enc,
+	}
+	err = signContribution(peersDB, &data)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
 	dataJSON, err := json.Marshal(data)
 	if err != nil {
 		logChan <- Log{Type: RecoverableErr, Data: err}
@@ -391,28 +805,55 @@ func post(peersDB *PeersDB, node files.Node, logChan chan Log) interface{} {
 
 	// add the contribution block
 	peersDB.ContributionsMtx.Lock()
-	_, err = (*db).Add(ctx, dataJSON)
+	op, err := (*db).Add(ctx, dataJSON)
 	if err != nil {
 		logChan <- Log{Type: RecoverableErr, Data: err}
 		return err
 	}
 	peersDB.ContributionsMtx.Unlock()
+	peersDB.Moderation.Record(op.GetEntry().GetHash().String(), ownID)
 
 	return "File uploaded"
 }
 
 // executes connect command
 func connect(peersDB *PeersDB, peerId string, logChan chan Log) string {
-	ctx := context.Background()
-	err := ipfs.ConnectToPeers(ctx, peersDB.Orbit, []string{peerId})
+	info, err := peer.AddrInfoFromString(peerId)
+	if err == nil {
+		peersDB.KnownPeers.Undisconnect(info.ID.String())
+	}
+
+	err = connectPeer(context.Background(), peersDB, []string{peerId})
 	if err != nil {
 		logChan <- Log{Type: RecoverableErr, Data: err}
 	}
+
 	return "Peer id processed"
 }
 
-// executes query command
-func query(peersDB *PeersDB, logChan chan Log) []Contribution {
+// connects to a peer given by its full addresses and remembers it if the
+// connection was successful. The store is exchanged once connected (see
+// awaitConnected).
+func connectPeer(ctx context.Context, peersDB *PeersDB, addrs []string) error {
+	err := ipfs.ConnectToPeers(ctx, peersDB.Orbit, addrs)
+	if err != nil {
+		return err
+	}
+
+	maddr, err := ma.NewMultiaddr(addrs[0])
+	if err != nil {
+		return err
+	}
+	info, err := peer.AddrInfoFromP2pAddr(maddr)
+	if err != nil {
+		return err
+	}
+	return recordPeer(peersDB, info.ID, addrs)
+}
+
+// executes query command, retracted contributions are only included if
+// withRetracted is set
+func query(peersDB *PeersDB, withRetracted bool, logChan chan Log) []QueryResult {
 	db := peersDB.Contributions
 	if db == nil {
 		err := errors.New("you need a datastore first, try connecting to a peer")
@@ -421,37 +862,58 @@ func query(peersDB *PeersDB, logChan chan Log) []Contribution {
 	}
 
 	// fetch data from network
-	infinity := -1
 	ctx := context.Background()
-	(*db).Load(ctx, infinity)
+	err := loadContributions(ctx, peersDB, *db)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+	}
 
 	// TODO : await ready event
 	time.Sleep(time.Second * 5)
 
-	// get all entries and parse them
-	res, err := (*db).List(ctx, &orbitdb.StreamOptions{Amount: &infinity})
+	// get all contributions
+	state, err := materialize(ctx, peersDB)
 	if err != nil {
 		logChan <- Log{Type: RecoverableErr, Data: err}
-		return []Contribution{}
+		return []QueryResult{}
 	}
 
-	jsonRes := make([]Contribution, len(res))
-	for i, op := range res {
-		err := json.Unmarshal(op.GetValue(), &jsonRes[i])
-		if err != nil {
-			logChan <- Log{Type: RecoverableErr, Data: err}
+	jsonRes := make([]QueryResult, 0, len(state.Records))
+	for _, r := range state.Records {
+		if !withRetracted && r.Retracted {
+			continue
+		}
+		if r.Blocked {
+			continue
+		}
+		if *config.FlagRejectUnverified && !r.Verified {
 			continue
 		}
 
 		// TODO : optionally filter by validity
-		valid, err := isValid(peersDB, jsonRes[i].Path)
-		if err == nil && valid {
-			fmt.Print("valid file found")
+		if !peersDB.Moderation.IsIgnored(r.Entry) {
+			valid, err := isValid(peersDB, r.Contribution.Path, logChan)
+			if err == nil && valid {
+				fmt.Print("valid file found")
+			}
+
+			if err != nil {
+				logChan <- Log{Type: RecoverableErr, Data: err}
+			}
 		}
 
-		if err != nil {
-			logChan <- Log{Type: RecoverableErr, Data: err}
+		result := QueryResult{Contribution: r.Contribution}
+		if r.Verified {
+			result.VerifiedAuthor = r.Contribution.Contributor
 		}
+		if peersDB.Annotations != nil {
+			result.Annotations, err = getAnnotations(peersDB, r.Contribution.Path)
+			if err != nil {
+				logChan <- Log{Type: RecoverableErr, Data: err}
+			}
+		}
+
+		jsonRes = append(jsonRes, result)
 	}
 
 	return jsonRes
@@ -465,7 +927,7 @@ type Validation struct {
 
 // checks if the file identified by the ipfs path is valid according to local
 // entries or peers
-func isValid(peersDB *PeersDB, path string) (bool, error) {
+func isValid(peersDB *PeersDB, path string, logChan chan Log) (bool, error) {
 	// check local entry
 	validations := *peersDB.Validations
 	getopts := iface.DocumentStoreGetOptions{
@@ -486,7 +948,7 @@ func isValid(peersDB *PeersDB, path string) (bool, error) {
 	}
 
 	// no local entry, so fetch votes via pubsub and accumulate them
-	validation, err := accValidations(peersDB, path)
+	validation, err := accValidations(peersDB, path, logChan)
 	if err != nil {
 		return false, err
 	}
@@ -522,11 +984,12 @@ const validationReqTopic = "validation"
 
 // requests and accumulates votes via pubsub
 // returns a probability between 0 and 1 for validity of data
-func accValidations(peersDB *PeersDB, pth string) (Validation, error) {
+func accValidations(peersDB *PeersDB, pth string, logChan chan Log) (Validation, error) {
 	// receive votes via topic : this nodes id + the files path
 	coreAPI := (*peersDB.Orbit).IPFS()
 	nodeId := (*peersDB.Config).PeerID
 	ctx := context.Background()
+	defer registerVoteValidator(peersDB, nodeId+pth, logChan)()
 	resSub, err := coreAPI.PubSub().Subscribe(ctx, nodeId+pth)
 	if err != nil {
 		return Validation{}, err
@@ -564,6 +1027,11 @@ func accValidations(peersDB *PeersDB, pth string) (Validation, error) {
 				continue
 			}
 
+			// votes of blocked peers don't count
+			if peersDB.Blocklist.IsBlocked(msg.From().String()) {
+				continue
+			}
+
 			// accumulate votes
 			var res ValidationRes
 			err = json.Unmarshal(msg.Data(), &res)
@@ -633,6 +1101,9 @@ func awaitValidationReq(peersDB *PeersDB, logChan chan Log) {
 			logChan <- Log{RecoverableErr, err}
 			continue
 		}
+		if peersDB.Blocklist.IsBlocked(msg.From().String()) {
+			continue
+		}
 
 		var validationReq ValidationReq
 		err = json.Unmarshal(msg.Data(), &validationReq)
@@ -649,7 +1120,8 @@ func awaitValidationReq(peersDB *PeersDB, logChan chan Log) {
 			continue
 		}
 
-		// no internal vote
+		// no internal vote, that's also the case for spam since contributions
+		// above the limit are never validated (see awaitReplicateEvent)
 		// TODO : should be reason to listen to the voting topic aswell right ?
 		if len(res) < 1 {
 			continue
@@ -729,6 +1201,11 @@ func awaitReplicateEvent(peersDB *PeersDB, logChan chan Log) {
 
 		logChan <- Log{Info, fmt.Sprintf("Replicated event with %d entries", len(entries))}
 		for _, entry := range entries {
+			// ignore everything signed by blocked identities
+			if peersDB.Blocklist.IsBlocked(entry.GetIdentity().ID) {
+				continue
+			}
+
 			// get the ipfs-log operation from the entry
 			opStr := entry.GetPayload()
 			var op opDoc
@@ -738,6 +1215,19 @@ func awaitReplicateEvent(peersDB *PeersDB, logChan chan Log) {
 				continue
 			}
 
+			// snapshots are only of interest on startup
+			if isSnapshotRef(op.Value) {
+				continue
+			}
+
+			// withdraw retracted data
+			if isTombstone(op.Value) {
+				if *config.FlagHonourTombstones {
+					handleTombstone(peersDB, op.Value, entry.GetIdentity().ID, logChan)
+				}
+				continue
+			}
+
 			// parse to contribution block
 			var contribution Contribution
 			err = json.Unmarshal(op.Value, &contribution)
@@ -746,6 +1236,28 @@ func awaitReplicateEvent(peersDB *PeersDB, logChan chan Log) {
 				continue
 			}
 
+			if peersDB.Blocklist.IsBlocked(contribution.Contributor) {
+				continue
+			}
+
+			// flag contributions claiming someone else as contributor
+			err = verifyContributor(contribution, entry.GetIdentity().ID)
+			if err != nil {
+				logChan <- Log{RecoverableErr, fmt.Errorf("unverified contribution %s : %w",
+					contribution.Path, err)}
+				if *config.FlagRejectUnverified {
+					continue
+				}
+			}
+
+			// ignore contributions above the limit
+			if !peersDB.Moderation.Admit(entry.GetHash().String(), entry.GetIdentity().ID,
+				contribution, err == nil, newestParentTS(contributions, entry)) {
+				logChan <- Log{Info, "Ignoring " + contribution.Path + " of " +
+					entry.GetIdentity().ID + ", contribution limit exceeded or implausible creation time"}
+				continue
+			}
+
 			// store bootstrap and new contribution benchmark
 			if *config.FlagBenchmark {
 				peersDB.Benchmark.UpdateBootstrap(contribution.CreationTS)
@@ -759,7 +1271,12 @@ func awaitReplicateEvent(peersDB *PeersDB, logChan chan Log) {
 				ctx := context.Background()
 				parsedPth := path.New(pth)
 				opts := options.Pin.Recursive(true)
-				coreAPI.Pin().Add(ctx, parsedPth, opts)
+				err := coreAPI.Pin().Add(ctx, parsedPth, opts)
+				if err != nil {
+					logChan <- Log{RecoverableErr, err}
+					continue
+				}
+				auditPinChange(peersDB, auditPin, pth, logChan)
 			}
 		}
 	}
@@ -0,0 +1,326 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"peersdb/config"
+	"time"
+
+	orbitdb "berty.tech/go-orbit-db"
+	"berty.tech/go-orbit-db/iface"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+	"golang.org/x/net/context"
+)
+
+// a contribution block together with information on the eventlog entry which
+// holds it
+type contributionRecord struct {
+	Entry        string       `json:"entry"`  // cid of the eventlog entry
+	Signer       string       `json:"signer"` // orbitdb identity which signed the entry
+	Contribution Contribution `json:"contribution"`
+	Retracted    bool         `json:"retracted"`
+	Verified     bool         `json:"verified"` // whether the contributor is bound to the signer
+
+	// whether the signer or contributor is on our blocklist, that's local
+	// policy, so it's not part of snapshots
+	Blocked bool `json:"-"`
+}
+
+// a snapshot is the materialized contributions state at some point of the
+// eventlog. Snapshots are stored in ipfs and referenced from the eventlog, so
+// nodes only have to replay the entries after the latest snapshot on startup.
+type Snapshot struct {
+	Records    []contributionRecord `json:"records"`
+	Covered    []string             `json:"covered"`    // cids of all entries reflected by the records
+	CreationTS time.Time            `json:"creationTS"` // timestamp of creation
+}
+
+// the eventlog entry referencing a snapshot
+type SnapshotRef struct {
+	Snapshot   string    `json:"snapshot"`   // ipfs path of the snapshot
+	CreationTS time.Time `json:"creationTS"` // timestamp of creation
+}
+
+// how many entries are loaded at first when looking for the latest snapshot
+const snapshotLoadAmount = 64
+
+// checks whether an eventlog value holds a snapshot reference
+func isSnapshotRef(value []byte) bool {
+	var probe struct {
+		Snapshot string `json:"snapshot"`
+	}
+	err := json.Unmarshal(value, &probe)
+	return err == nil && probe.Snapshot != ""
+}
+
+// builds the current contributions state from the latest snapshot and the
+// loaded entries which are not covered by it
+func materialize(ctx context.Context, peersDB *PeersDB) (*Snapshot, error) {
+	db := peersDB.Contributions
+	if db == nil {
+		return nil, errors.New("you need a datastore first, try connecting to a peer")
+	}
+
+	infinity := -1
+	ops, err := (*db).List(ctx, &orbitdb.StreamOptions{Amount: &infinity})
+	if err != nil {
+		return nil, err
+	}
+
+	state := &Snapshot{CreationTS: time.Now()}
+	covered := make(map[string]bool)
+
+	peersDB.ContributionsMtx.RLock()
+	if peersDB.Snapshot != nil {
+		state.Records = append(state.Records, peersDB.Snapshot.Records...)
+		for _, c := range peersDB.Snapshot.Covered {
+			covered[c] = true
+		}
+	}
+	peersDB.ContributionsMtx.RUnlock()
+
+	type signedTombstone struct {
+		Tombstone
+		signer string
+	}
+
+	var tombstones []signedTombstone
+	for _, op := range ops {
+		// snapshot references are not part of the state, so they do not count
+		// as new entries either
+		value := op.GetValue()
+		if isSnapshotRef(value) {
+			continue
+		}
+
+		entry := op.GetEntry()
+		hash := entry.GetHash().String()
+		if covered[hash] {
+			continue
+		}
+		covered[hash] = true
+
+		// remember tombstones until all records are known
+		if isTombstone(value) {
+			var tombstone Tombstone
+			if json.Unmarshal(value, &tombstone) == nil {
+				tombstones = append(tombstones,
+					signedTombstone{tombstone, entry.GetIdentity().ID})
+			}
+			continue
+		}
+
+		var contribution Contribution
+		err := json.Unmarshal(value, &contribution)
+		if err != nil {
+			continue
+		}
+
+		state.Records = append(state.Records, contributionRecord{
+			Entry:        hash,
+			Signer:       entry.GetIdentity().ID,
+			Contribution: contribution,
+		})
+	}
+
+	// records of older snapshots may not have been verified yet
+	for i, r := range state.Records {
+		state.Records[i].Verified = verifyContributor(r.Contribution, r.Signer) == nil
+		state.Records[i].Blocked = peersDB.Blocklist.IsBlocked(r.Signer) ||
+			peersDB.Blocklist.IsBlocked(r.Contribution.Contributor)
+	}
+
+	// apply the tombstones which were signed by the retracted entries' signers
+	index := make(map[string]int, len(state.Records))
+	for i, r := range state.Records {
+		index[r.Entry] = i
+	}
+	for _, t := range tombstones {
+		for _, e := range t.Entries {
+			i, ok := index[e]
+			if ok && state.Records[i].Signer == t.signer {
+				state.Records[i].Retracted = true
+			}
+		}
+	}
+
+	for c := range covered {
+		state.Covered = append(state.Covered, c)
+	}
+
+	return state, nil
+}
+
+// loads the contributions eventlog up to the latest trusted snapshot, if there
+// is none the whole log is replayed
+func loadContributions(ctx context.Context, peersDB *PeersDB, db iface.EventLogStore) error {
+	amount := snapshotLoadAmount
+	for {
+		err := db.Load(ctx, amount)
+		if err != nil {
+			return err
+		}
+
+		ops, err := db.List(ctx, &orbitdb.StreamOptions{Amount: &amount})
+		if err != nil {
+			return err
+		}
+
+		// find the latest trusted snapshot among the loaded entries
+		var latest *SnapshotRef
+		for _, op := range ops {
+			if !isSnapshotRef(op.GetValue()) {
+				continue
+			}
+			if !trustedSnapshotSigner(peersDB, op.GetEntry().GetIdentity().ID) {
+				continue
+			}
+
+			var ref SnapshotRef
+			if json.Unmarshal(op.GetValue(), &ref) != nil {
+				continue
+			}
+			if latest == nil || ref.CreationTS.After(latest.CreationTS) {
+				latest = &ref
+			}
+		}
+
+		if latest != nil {
+			snapshot, err := fetchSnapshot(ctx, peersDB, latest.Snapshot)
+			if err != nil {
+				return err
+			}
+
+			peersDB.ContributionsMtx.Lock()
+			peersDB.Snapshot = snapshot
+			peersDB.ContributionsMtx.Unlock()
+			return nil
+		}
+
+		// the whole log has been loaded
+		if len(ops) < amount {
+			return nil
+		}
+		amount *= 2
+	}
+}
+
+// only snapshots of ourselves or configured identities are used, since
+// a snapshot could hide or forge contributions
+func trustedSnapshotSigner(peersDB *PeersDB, signer string) bool {
+	if signer == (*peersDB.Orbit).Identity().ID {
+		return true
+	}
+
+	for _, s := range peersDB.Config.TrustedSnapshotSigners {
+		if s == signer {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reads a snapshot from ipfs
+func fetchSnapshot(ctx context.Context, peersDB *PeersDB, ipfsPath string) (*Snapshot, error) {
+	coreAPI := (*peersDB.Orbit).IPFS()
+	n, err := coreAPI.Unixfs().Get(ctx, path.New(ipfsPath))
+	if err != nil {
+		return nil, err
+	}
+
+	file, ok := n.(files.File)
+	if !ok {
+		return nil, fmt.Errorf("snapshot %s is not a file", ipfsPath)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// stores the current contributions state in ipfs and references it from the
+// eventlog, nothing is done if there are no new entries since the last snapshot
+func createSnapshot(peersDB *PeersDB, logChan chan Log) {
+	ctx := context.Background()
+	coreAPI := (*peersDB.Orbit).IPFS()
+
+	state, err := materialize(ctx, peersDB)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+
+	peersDB.ContributionsMtx.RLock()
+	unchanged := len(state.Covered) == 0 || (peersDB.Snapshot != nil &&
+		len(peersDB.Snapshot.Covered) == len(state.Covered))
+	peersDB.ContributionsMtx.RUnlock()
+	if unchanged {
+		return
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+
+	// pin the snapshot, otherwise it could be garbage collected
+	snapshotPath, err := coreAPI.Unixfs().Add(ctx, files.NewBytesFile(data),
+		options.Unixfs.Pin(true))
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+	auditPinChange(peersDB, auditPin, snapshotPath.String(), logChan)
+
+	ref := SnapshotRef{snapshotPath.String(), state.CreationTS}
+	refJSON, err := json.Marshal(ref)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+
+	peersDB.ContributionsMtx.Lock()
+	defer peersDB.ContributionsMtx.Unlock()
+	_, err = (*peersDB.Contributions).Add(ctx, refJSON)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+	peersDB.Snapshot = state
+
+	logChan <- Log{Info, "Created contributions snapshot " + ref.Snapshot}
+}
+
+// periodically creates snapshots of the contributions state
+func snapshotPeriodically(peersDB *PeersDB, logChan chan Log) {
+	interval := *config.FlagSnapshotInterval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if peersDB.Contributions == nil {
+			continue
+		}
+		createSnapshot(peersDB, logChan)
+	}
+}
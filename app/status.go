@@ -0,0 +1,86 @@
+package app
+
+import (
+	"peersdb/ipfs"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// the state of this node as seen from the network
+type Status struct {
+	PeerID       string   `json:"peerID"`
+	Identity     string   `json:"identity"`     // orbitdb identity, used for access control
+	Reachability string   `json:"reachability"` // Unknown, Public or Private as detected by AutoNAT
+	Addrs        []string `json:"addrs"`        // addresses announced to other peers, including relay addresses
+	Peers        int      `json:"peers"`        // number of connected peers
+	Store        string   `json:"store"`        // address of the contributions store, if any
+}
+
+// keeps track of the reachability reported by AutoNAT
+func trackReachability(peersDB *PeersDB, logChan chan Log) {
+	sub, err := peersDB.Node.PeerHost.EventBus().Subscribe(
+		new(event.EvtLocalReachabilityChanged))
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return
+	}
+	defer sub.Close()
+
+	for e := range sub.Out() {
+		e, ok := e.(event.EvtLocalReachabilityChanged)
+		if !ok {
+			continue
+		}
+
+		peersDB.StatusMtx.Lock()
+		peersDB.Reachability = e.Reachability
+		peersDB.StatusMtx.Unlock()
+		logChan <- Log{Info, "Reachability changed to " + e.Reachability.String()}
+	}
+}
+
+// executes status command
+func status(peersDB *PeersDB) Status {
+	host := peersDB.Node.PeerHost
+
+	peersDB.StatusMtx.RLock()
+	reachability := peersDB.Reachability
+	peersDB.StatusMtx.RUnlock()
+
+	res := Status{
+		PeerID:       host.ID().String(),
+		Identity:     (*peersDB.Orbit).Identity().ID,
+		Reachability: reachability.String(),
+		Addrs:        ipfs.PeerAddrs(peersDB.Node, false),
+		Peers:        len(host.Network().Peers()),
+	}
+	if peersDB.Contributions != nil {
+		res.Store = (*peersDB.Contributions).Address().String()
+	}
+
+	return res
+}
+
+// waits until there is a direct connection to the given peer. Relayed
+// connections are transient, pubsub does not use them, so peers behind NAT
+// have to wait for hole punching before exchanging stores.
+func awaitDirectConn(peersDB *PeersDB, id peer.ID, timeout time.Duration) bool {
+	net := peersDB.Node.PeerHost.Network()
+	deadline := time.Now().Add(timeout)
+
+	for {
+		for _, c := range net.ConnsToPeer(id) {
+			if !c.Stat().Transient {
+				return true
+			}
+		}
+
+		if time.Now().After(deadline) || net.Connectedness(id) != network.Connected {
+			return false
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,196 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"peersdb/config"
+	"time"
+)
+
+// the files the self-signed development certificate is generated into
+func devCertPaths() (string, string) {
+	return *config.FlagRepo + "_tls.crt", *config.FlagRepo + "_tls.key"
+}
+
+// the scheme the http apis of other nodes are called with, all nodes of a
+// network are expected to use the same
+func APIScheme() string {
+	if *config.FlagTLS {
+		return "https"
+	}
+	return "http"
+}
+
+// returns the configured certificate files, if none are configured a
+// self-signed certificate is generated into the repo
+func certPaths() (string, string, error) {
+	if *config.FlagTLSCert != "" || *config.FlagTLSKey != "" {
+		if *config.FlagTLSCert == "" || *config.FlagTLSKey == "" {
+			return "", "", errors.New("-tls-cert and -tls-key have to be given together")
+		}
+		return *config.FlagTLSCert, *config.FlagTLSKey, nil
+	}
+
+	certPath, keyPath := devCertPaths()
+	_, err := os.Stat(certPath)
+	if err == nil {
+		return certPath, keyPath, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", "", err
+	}
+
+	err = generateDevCert(certPath, keyPath)
+	if err != nil {
+		return "", "", err
+	}
+	return certPath, keyPath, nil
+}
+
+// generates a self-signed certificate for localhost and the addresses of all
+// interfaces, it is meant for development only
+func generateDevCert(certPath string, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"peersdb development"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		tmpl.DNSNames = append(tmpl.DNSNames, hostname)
+	}
+	ifAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return err
+	}
+	for _, a := range ifAddrs {
+		if ipNet, ok := a.(*net.IPNet); ok {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ipNet.IP)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(certPath,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyPath,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
+
+func loadCertificate() (tls.Certificate, error) {
+	certPath, keyPath, err := certPaths()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.LoadX509KeyPair(certPath, keyPath)
+}
+
+// the certificates other nodes' certificates are verified against, nil means
+// the system roots
+func caPool() (*x509.CertPool, error) {
+	if *config.FlagTLSCA == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(*config.FlagTLSCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates found in " + *config.FlagTLSCA)
+	}
+	return pool, nil
+}
+
+// tls config of the http api, with mutual tls the clients have to present a
+// certificate signed by the configured CA
+func ServerTLSConfig() (*tls.Config, error) {
+	cert, err := loadCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if *config.FlagMTLS {
+		pool, err := caPool()
+		if err != nil {
+			return nil, err
+		}
+		if pool == nil {
+			return nil, errors.New("mutual tls needs a CA, set -tls-ca")
+		}
+		tlsConf.ClientCAs = pool
+		tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConf, nil
+}
+
+// creates the client used to call the http apis of other nodes. With mutual
+// tls it authenticates with our own certificate.
+func NewAPIClient() (*http.Client, error) {
+	if !*config.FlagTLS {
+		return &http.Client{}, nil
+	}
+
+	pool, err := caPool()
+	if err != nil {
+		return nil, err
+	}
+	tlsConf := &tls.Config{
+		RootCAs:            pool,
+		InsecureSkipVerify: *config.FlagTLSSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if *config.FlagMTLS {
+		cert, err := loadCertificate()
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConf}}, nil
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/interface-go-ipfs-core/path"
+	"golang.org/x/net/context"
+)
+
+// a tombstone is appended to the contributions eventlog to withdraw earlier
+// contributions. Since the log is append-only the original entries stay, but
+// peers hide them and may drop the referenced data.
+// A tombstone is only honoured if it was signed by the same orbitdb identity
+// as every entry it retracts.
+type Tombstone struct {
+	Retracts    string    `json:"retracts"`    // ipfs path of the retracted contribution
+	Entries     []string  `json:"entries"`     // cids of the retracted eventlog entries
+	Contributor string    `json:"contributor"` // ipfs node id
+	CreationTS  time.Time `json:"creationTS"`  // timestamp of retraction
+}
+
+// checks whether an eventlog value holds a tombstone instead of a contribution
+// block
+func isTombstone(value []byte) bool {
+	var probe struct {
+		Retracts string `json:"retracts"`
+	}
+	err := json.Unmarshal(value, &probe)
+	return err == nil && probe.Retracts != ""
+}
+
+// executes retract command
+func retract(peersDB *PeersDB, ipfsPath string, logChan chan Log) interface{} {
+	ctx := context.Background()
+
+	// contributions store may be nil for non-root nodes
+	db := peersDB.Contributions
+	if db == nil {
+		err := errors.New("you need a datastore first, try connecting to a peer")
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	state, err := materialize(ctx, peersDB)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	// only our own entries can be retracted, anything else would be rejected
+	// by other peers anyway
+	ownID := (*db).Identity().ID
+	var entries []string
+	for _, r := range state.Records {
+		if r.Retracted || r.Signer != ownID || r.Contribution.Path != ipfsPath {
+			continue
+		}
+		entries = append(entries, r.Entry)
+	}
+
+	if len(entries) == 0 {
+		err := fmt.Errorf("no contribution of this node found for %s", ipfsPath)
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	tombstone := Tombstone{ipfsPath, entries, peersDB.Config.PeerID, time.Now()}
+	tombstoneJSON, err := json.Marshal(tombstone)
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	peersDB.ContributionsMtx.Lock()
+	_, err = (*db).Add(ctx, tombstoneJSON)
+	peersDB.ContributionsMtx.Unlock()
+	if err != nil {
+		logChan <- Log{Type: RecoverableErr, Data: err}
+		return err
+	}
+
+	// the retracted data should not be served by us anymore
+	unpin(peersDB, ipfsPath, logChan)
+
+	return "Retracted " + ipfsPath
+}
+
+// checks that every entry referenced by the tombstone exists, belongs to the
+// retracted path and was signed by the given identity
+func verifyTombstone(state *Snapshot, tombstone Tombstone, signer string) error {
+	if len(tombstone.Entries) == 0 {
+		return errors.New("tombstone does not reference any entries")
+	}
+
+	records := make(map[string]contributionRecord, len(state.Records))
+	for _, r := range state.Records {
+		records[r.Entry] = r
+	}
+
+	for _, e := range tombstone.Entries {
+		r, ok := records[e]
+		if !ok {
+			return fmt.Errorf("retracted entry %s is unknown", e)
+		}
+
+		if r.Signer != signer {
+			return fmt.Errorf("tombstone for %s was not signed by the original contributor", e)
+		}
+
+		if r.Contribution.Path != tombstone.Retracts {
+			return fmt.Errorf("entry %s does not hold %s", e, tombstone.Retracts)
+		}
+	}
+
+	return nil
+}
+
+// handles a replicated tombstone by unpinning the retracted data, if tombstones
+// are honoured
+func handleTombstone(peersDB *PeersDB, value []byte, signer string, logChan chan Log) {
+	var tombstone Tombstone
+	err := json.Unmarshal(value, &tombstone)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+
+	state, err := materialize(context.Background(), peersDB)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+
+	err = verifyTombstone(state, tombstone, signer)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+
+	logChan <- Log{Info, "Contribution " + tombstone.Retracts + " has been retracted"}
+	unpin(peersDB, tombstone.Retracts, logChan)
+}
+
+// removes the pin for the given ipfs path if there is one
+func unpin(peersDB *PeersDB, ipfsPath string, logChan chan Log) {
+	coreAPI := (*peersDB.Orbit).IPFS()
+	ctx := context.Background()
+
+	parsedPth := path.New(ipfsPath)
+	_, pinned, err := coreAPI.Pin().IsPinned(ctx, parsedPth)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+	if !pinned {
+		return
+	}
+
+	err = coreAPI.Pin().Rm(ctx, parsedPth)
+	if err != nil {
+		logChan <- Log{RecoverableErr, err}
+		return
+	}
+	auditPinChange(peersDB, auditUnpin, ipfsPath, logChan)
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"berty.tech/go-orbit-db/address"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// the most bytes accepted per message on our topics
+const (
+	maxStoreAddrSize     = 1024
+	maxValidationReqSize = 1024
+	maxValidationResSize = 64
+	maxHeartbeatSize     = 8 * 1024
+	maxJoinRequestSize   = 16 * 1024
+)
+
+// wraps a check into a gossipsub validator. Messages of blocked peers are
+// ignored. Messages which are too big or fail the check are rejected, so they
+// are not propagated and, on scored topics, lower the score of the peer which
+// delivered them.
+func topicValidator(peersDB *PeersDB, maxSize int, check func(*pubsub.Message) error,
+	logChan chan Log) pubsub.ValidatorEx {
+
+	return func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		// the forwarder is not to blame for the origin, so these are neither
+		// propagated nor penalized
+		if len(msg.Signature) == 0 || len(msg.From) == 0 ||
+			peersDB.Blocklist.IsBlocked(msg.GetFrom().String()) {
+			return pubsub.ValidationIgnore
+		}
+
+		err := func() error {
+			if len(msg.Data) > maxSize {
+				return fmt.Errorf("message of %d bytes exceeds %d bytes", len(msg.Data), maxSize)
+			}
+			return check(msg)
+		}()
+		if err == nil {
+			return pubsub.ValidationAccept
+		}
+
+		if !msg.Local {
+			logChan <- Log{RecoverableErr, fmt.Errorf("rejected message of %s from %s on %s : %w",
+				msg.GetFrom(), from, msg.GetTopic(), err)}
+		}
+		return pubsub.ValidationReject
+	}
+}
+
+// the store exchange topic carries the address of a contributions store
+func checkStoreAddr(msg *pubsub.Message) error {
+	_, err := address.Parse(string(msg.Data))
+	return err
+}
+
+// validation requests have to name an ipfs path and their sender
+func checkValidationReq(msg *pubsub.Message) error {
+	var req ValidationReq
+	err := json.Unmarshal(msg.Data, &req)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(req.Path, "/ipfs/") || path.New(req.Path).IsValid() != nil {
+		return errors.New("invalid path " + req.Path)
+	}
+	if req.PeerID != msg.GetFrom().String() {
+		return errors.New("validation request for another peer")
+	}
+	return nil
+}
+
+func checkValidationRes(msg *pubsub.Message) error {
+	var res ValidationRes
+	return json.Unmarshal(msg.Data, &res)
+}
+
+// heartbeats may only announce their sender
+func checkHeartbeat(msg *pubsub.Message) error {
+	var hb Heartbeat
+	err := json.Unmarshal(msg.Data, &hb)
+	if err != nil {
+		return err
+	}
+	if hb.PeerID != msg.GetFrom().String() {
+		return errors.New("heartbeat of another peer")
+	}
+	return nil
+}
+
+// join requests carry a claim encrypted for the topic's owner, who checks it
+func checkJoinRequest(msg *pubsub.Message) error {
+	var req JoinRequest
+	err := json.Unmarshal(msg.Data, &req)
+	if err != nil {
+		return err
+	}
+	if len(req.Claim) == 0 || len(req.Encryption.Keys) != 1 {
+		return errors.New("join request without claim")
+	}
+	return nil
+}
+
+type topicCheck struct {
+	topic   string
+	maxSize int
+	check   func(*pubsub.Message) error
+}
+
+// the static peersdb topics of the node with the given peer id
+func topicChecks(self string) []topicCheck {
+	return []topicCheck{
+		{self, maxStoreAddrSize, checkStoreAddr},
+		{validationReqTopic, maxValidationReqSize, checkValidationReq},
+		{heartbeatTopic, maxHeartbeatSize, checkHeartbeat},
+		{joinTopicPrefix + self, maxJoinRequestSize, checkJoinRequest},
+	}
+}
+
+// the topics on which invalid messages lower the peer score, vote topics only
+// live for a single validation and are not scored
+func scoredTopics(self string) []string {
+	var topics []string
+	for _, c := range topicChecks(self) {
+		topics = append(topics, c.topic)
+	}
+	return topics
+}
+
+// registers the validators of all static peersdb topics
+func registerValidators(peersDB *PeersDB, logChan chan Log) error {
+	for _, v := range topicChecks(peersDB.Config.PeerID) {
+		err := peersDB.Node.PubSub.RegisterTopicValidator(v.topic,
+			topicValidator(peersDB, v.maxSize, v.check, logChan))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registers the validator of a vote topic, the returned function removes it
+// again. If the topic already has one, e.g. because of a concurrent request
+// for the same path, nothing is registered.
+func registerVoteValidator(peersDB *PeersDB, topic string, logChan chan Log) func() {
+	err := peersDB.Node.PubSub.RegisterTopicValidator(topic,
+		topicValidator(peersDB, maxValidationResSize, checkValidationRes, logChan))
+	if err != nil {
+		return func() {}
+	}
+	return func() {
+		peersDB.Node.PubSub.UnregisterTopicValidator(topic)
+	}
+}
@@ -10,6 +10,51 @@ type Config struct {
 	ContributionsStoreAddr string `json:"contributionsStoreAddr"`
 	ValidationsStoreAddr   string `json:"validationsStoreAddr"`
 	PeerID                 string `json:"peerID"`
+
+	// the id the orbitdb identity is created for. It's the first peer id of the
+	// node and stays the same when the key is rotated, so the node keeps its
+	// store permissions.
+	OrbitID string `json:"orbitID"`
+
+	// orbitdb identities whose contributions snapshots are trusted next to
+	// our own
+	TrustedSnapshotSigners []string `json:"trustedSnapshotSigners"`
+
+	// peer ids encrypted contributions are readable for, next to our own
+	Members []string `json:"members"`
+
+	// tokens accepted by the http api, if there are none the api only accepts
+	// requests from this machine
+	APIKeys []APIKey `json:"apiKeys"`
+
+	// token sent along with http requests to other nodes
+	PeerAPIKey string `json:"peerAPIKey"`
+}
+
+// scopes of the http api, every scope includes the ones before it
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// a token for the http api and what it may be used for
+type APIKey struct {
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"` // read, write and/or admin
+}
+
+// checks whether the key grants the given scope, a higher scope includes the
+// lower ones
+func (k APIKey) HasScope(scope string) bool {
+	rank := map[string]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+	for _, s := range k.Scopes {
+		if rank[s] >= rank[scope] && rank[scope] > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // TODO : store config and cache in appropriate directories
@@ -54,10 +99,12 @@ func SaveStructAsJSON(s interface{}, path string) error {
 		return err
 	}
 
-	err = ioutil.WriteFile(path, data, 0644)
+	// the files hold tokens and other state only the owner should read,
+	// WriteFile keeps the mode of existing files
+	err = ioutil.WriteFile(path, data, 0600)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return os.Chmod(path, 0600)
 }
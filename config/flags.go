@@ -1,12 +1,22 @@
 package config
 
-import "flag"
+import (
+	"flag"
+	"time"
+)
 
 var FlagShell = flag.Bool("shell", false, "enable shell interface")
 var FlagHTTP = flag.Bool("http", false, "enable http interface")
 
 var FlagIPFSPort = flag.String("ipfs-port", "4001", "configure ipfs port")
+var FlagListen = flag.String("listen", "", "comma separated multiaddrs to listen on, defaults to all interfaces on the ipfs port")
+var FlagAnnounce = flag.String("announce", "", "comma separated multiaddrs to announce to other peers instead of the detected ones")
+var FlagNoAnnounce = flag.String("no-announce", "", "comma separated multiaddrs or ipcidr filters which are never announced")
+var FlagQUIC = flag.Bool("quic", false, "enable the QUIC transport, listens on the udp ipfs port")
+var FlagWebsocket = flag.Bool("websocket", false, "enable the websocket transport")
+var FlagWebsocketPort = flag.String("ws-port", "4002", "configure the websocket port")
 var FlagHTTPPort = flag.String("http-port", "8080", "configure http port")
+var FlagCORSOrigins = flag.String("cors-origins", "", "comma separated origins of web pages which may call the http api, pages of other origins are refused")
 
 var FlagExp = flag.Bool("experimental", true, "enable ipfs experimental features")
 var FlagRepo = flag.String("repo", "peersdb", "configure the repo/directory name for the ipfs node")
@@ -14,6 +24,47 @@ var FlagDevLogs = flag.Bool("devlogs", false, "enable development level logging
 var FlagRoot = flag.Bool("root", false, "creating a root node means it's possible to create a new datastore")
 var FlagDownloadDir = flag.String("download-dir", "~/Downloads/", "the destination path for downloaded data")
 var FlagFullReplica = flag.Bool("full-replica", false, "pins all added data")
-var FlagBootstrap = flag.String("bootstrap", "", "set a bootstrap peer to connect to on startup")
+var FlagSnapshotInterval = flag.Duration("snapshot-interval", time.Hour, "how often to snapshot the contributions eventlog, 0 disables snapshots")
+var FlagHonourTombstones = flag.Bool("honour-tombstones", true, "unpins data which has been retracted by its contributor")
+var FlagBootstrap = flag.String("bootstrap", "", "comma separated multiaddrs of bootstrap peers to connect to on startup, plain IPs use the legacy http connect")
+var FlagDiscovery = flag.Bool("discovery", true, "find peers of the contributions store via dht rendezvous")
+var FlagStore = flag.String("store", "", "address of the contributions store to join, its peers are discovered via the dht")
+var FlagAutoNAT = flag.Bool("autonat", true, "help other peers to find out whether they are reachable")
+var FlagHolePunching = flag.Bool("hole-punching", true, "try to establish direct connections through NATs")
+var FlagRelayClient = flag.Bool("relay-client", true, "use circuit relays if this node is not publicly reachable")
+var FlagRelayService = flag.Bool("relay-service", false, "act as circuit relay for peers behind NAT")
+var FlagStaticRelays = flag.String("static-relays", "", "comma separated multiaddrs of relays to use instead of discovering them")
+var FlagNATPortMap = flag.Bool("nat-portmap", true, "try to open a port on the router via UPnP/NAT-PMP")
+var FlagConnLow = flag.Int("conn-low", 0, "connection manager low watermark, 0 uses the kubo default")
+var FlagConnHigh = flag.Int("conn-high", 0, "connection manager high watermark, 0 uses the kubo default")
+var FlagConnGrace = flag.Duration("conn-grace", 0, "how long new connections are kept before they may be pruned, 0 uses the kubo default")
+var FlagResourceMgr = flag.Bool("rcmgr", true, "enable the libp2p resource manager")
+var FlagMaxMemory = flag.String("rcmgr-max-memory", "", "memory the libp2p resource manager may use, e.g. 2GB, empty uses the kubo default")
+var FlagMaxFDs = flag.Int("rcmgr-max-fds", 0, "file descriptors the libp2p resource manager may use, 0 uses the kubo default")
+var FlagLimits = flag.String("rcmgr-limits", "", "path to a json file with libp2p resource manager limits for single scopes")
+var FlagHeartbeatInterval = flag.Duration("heartbeat-interval", 30*time.Second, "how often to announce this node on the heartbeat topic, 0 disables heartbeats")
+var FlagPeerExpiry = flag.Duration("peer-expiry", 90*time.Second, "after how long without heartbeat a peer is dropped from the directory")
+var FlagRateLimit = flag.Int("rate-limit", 0, "bandwidth limit in KiB/s per direction for all peers together, 0 disables it")
+var FlagPeerRateLimit = flag.Int("peer-rate-limit", 0, "bandwidth limit in KiB/s per direction for each peer, 0 disables it")
+var FlagWriters = flag.String("writers", "", "comma separated orbitdb identities which may write to a newly created contributions store besides this node, * allows everyone")
+var FlagShareStore = flag.Bool("share-store", false, "send the contributions store address to every connecting peer, otherwise nodes join via invite tokens or -store")
+var FlagPrivate = flag.Bool("private", false, "run in a private network, only peers with the same swarm key can connect")
+var FlagSwarmKey = flag.String("swarm-key", "", "path to the swarm key of the private network, a new key is generated if neither this nor a key in the repo exists")
+var FlagContributionLimit = flag.Int("contribution-limit", 0, "how many contributions an identity may add per window, 0 disables the limit")
+var FlagContributionWindow = flag.Duration("contribution-window", time.Hour, "the time window of the contribution limit")
+var FlagRejectUnverified = flag.Bool("reject-unverified", false, "hide contributions whose contributor does not match the signing identity and don't pin them")
+var FlagEncrypt = flag.Bool("encrypt", false, "encrypt all posted contributions for the members in the config")
+var FlagKeyType = flag.String("key-type", "ed25519", "type of the key a new repo is created with, ed25519 or rsa")
+var FlagKeyBits = flag.Int("key-bits", 2048, "size of the key a new repo is created with, only applies to rsa")
+var FlagIdentity = flag.String("identity", "", "path to an exported identity a new repo is created with")
+var FlagTLS = flag.Bool("tls", false, "serve the http api via https and call other nodes via https")
+var FlagTLSCert = flag.String("tls-cert", "", "path to the certificate of the http api, a self-signed one is generated into the repo if none is given")
+var FlagTLSKey = flag.String("tls-key", "", "path to the private key of the http api certificate")
+var FlagTLSCA = flag.String("tls-ca", "", "path to the CA certificates other nodes' certificates are verified against, the system roots are used if none is given")
+var FlagMTLS = flag.Bool("mtls", false, "require client certificates signed by -tls-ca on the http api and present ours to other nodes")
+var FlagTLSSkipVerify = flag.Bool("tls-skip-verify", false, "don't verify the certificates of other nodes, for development only")
+var FlagAudit = flag.Bool("audit", true, "record commands, store writes and pin changes in the audit log")
+var FlagAuditMaxSize = flag.Int("audit-max-size", 10, "size in MB after which the audit log is compressed and rotated, 0 disables rotation")
+var FlagAuditKeep = flag.Int("audit-keep", 0, "how many rotated audit logs are kept, 0 keeps all of them")
 var FlagBenchmark = flag.Bool("benchmark", false, "enable benchmarking")
 var FlagRegion = flag.String("region", "", "the region this node is working from")
@@ -0,0 +1,92 @@
+package ipfs
+
+import (
+	"sort"
+	"strings"
+
+	peersdbConf "peersdb/config"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// splits a comma separated list of multiaddrs
+func splitAddrs(list string) []string {
+	res := []string{}
+	for _, a := range strings.Split(list, ",") {
+		a = strings.TrimSpace(a)
+		if a != "" {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// returns the addresses to listen on. If none are configured, all interfaces
+// are used with the ipfs port and the enabled transports.
+func listenAddrs() []string {
+	if addrs := splitAddrs(*peersdbConf.FlagListen); len(addrs) > 0 {
+		return addrs
+	}
+
+	port := *peersdbConf.FlagIPFSPort
+	addrs := []string{
+		"/ip4/0.0.0.0/tcp/" + port,
+		"/ip6/::/tcp/" + port,
+	}
+	// QUIC doesn't support pre-shared keys, so it's disabled in private mode
+	if *peersdbConf.FlagQUIC && !*peersdbConf.FlagPrivate {
+		addrs = append(addrs,
+			"/ip4/0.0.0.0/udp/"+port+"/quic-v1",
+			"/ip6/::/udp/"+port+"/quic-v1",
+		)
+	}
+	if *peersdbConf.FlagWebsocket {
+		wsPort := *peersdbConf.FlagWebsocketPort
+		addrs = append(addrs,
+			"/ip4/0.0.0.0/tcp/"+wsPort+"/ws",
+			"/ip6/::/tcp/"+wsPort+"/ws",
+		)
+	}
+	return addrs
+}
+
+// converts a bool into a kubo config flag
+func configFlag(b bool) config.Flag {
+	if b {
+		return config.True
+	}
+	return config.False
+}
+
+// returns the full addresses other peers can reach this node at. They are
+// taken from the libp2p host, so they respect the announce settings and
+// include the addresses other peers observed us at. Public addresses come
+// first, loopback addresses are only returned if asked for.
+func PeerAddrs(node *core.IpfsNode, loopback bool) []string {
+	host := node.PeerHost
+
+	var addrs []ma.Multiaddr
+	for _, a := range host.Addrs() {
+		if manet.IsIPLoopback(a) == loopback {
+			addrs = append(addrs, a)
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return manet.IsPublicAddr(addrs[i]) && !manet.IsPublicAddr(addrs[j])
+	})
+
+	p2pAddrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: host.ID(), Addrs: addrs})
+	if err != nil {
+		return nil
+	}
+
+	res := make([]string, 0, len(p2pAddrs))
+	for _, a := range p2pAddrs {
+		res = append(res, a.String())
+	}
+	return res
+}
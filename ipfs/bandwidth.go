@@ -0,0 +1,214 @@
+package ipfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/metrics"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// bounds of the per peer traffic counters. Counters of disconnected peers are
+// dropped after trafficRetention, at most maxTrafficPeers peers are tracked.
+const (
+	trafficRetention = time.Hour
+	maxTrafficPeers  = 1024
+)
+
+// bytes sent to and received from a peer over one protocol
+type Traffic struct {
+	In  int64 `json:"in"`
+	Out int64 `json:"out"`
+}
+
+// a bandwidth reporter which counts the traffic per peer and protocol and
+// throttles streams if limits are set. It wraps the reporter kubo installs,
+// so kubo's own metrics keep working.
+//
+// libp2p reports every stream read and write right after it happened, blocking
+// in the report delays the next read or write on that stream. That's how the
+// limits are enforced.
+type BandwidthMeter struct {
+	metrics.Reporter
+
+	mtx     sync.Mutex
+	traffic map[peer.ID]map[protocol.ID]*Traffic
+	active  map[peer.ID]time.Time // last traffic per peer
+
+	// limits in bytes per second and direction, 0 means unlimited
+	limit     int64
+	peerLimit int64
+
+	in, out         *limiter
+	peerIn, peerOut map[peer.ID]*limiter
+}
+
+// creates a meter with the given limits in bytes per second and direction
+func NewBandwidthMeter(limit, peerLimit int64) *BandwidthMeter {
+	return &BandwidthMeter{
+		traffic:   make(map[peer.ID]map[protocol.ID]*Traffic),
+		active:    make(map[peer.ID]time.Time),
+		limit:     limit,
+		peerLimit: peerLimit,
+		in:        newLimiter(limit),
+		out:       newLimiter(limit),
+		peerIn:    make(map[peer.ID]*limiter),
+		peerOut:   make(map[peer.ID]*limiter),
+	}
+}
+
+func (bm *BandwidthMeter) LogSentMessageStream(size int64, proto protocol.ID, p peer.ID) {
+	bm.Reporter.LogSentMessageStream(size, proto, p)
+
+	bm.mtx.Lock()
+	bm.count(proto, p).Out += size
+	peerLim := bm.peerLimiter(bm.peerOut, p)
+	bm.mtx.Unlock()
+
+	bm.out.wait(size)
+	peerLim.wait(size)
+}
+
+func (bm *BandwidthMeter) LogRecvMessageStream(size int64, proto protocol.ID, p peer.ID) {
+	bm.Reporter.LogRecvMessageStream(size, proto, p)
+
+	bm.mtx.Lock()
+	bm.count(proto, p).In += size
+	peerLim := bm.peerLimiter(bm.peerIn, p)
+	bm.mtx.Unlock()
+
+	bm.in.wait(size)
+	peerLim.wait(size)
+}
+
+// returns the traffic counter of a peer and protocol, mtx has to be held
+func (bm *BandwidthMeter) count(proto protocol.ID, p peer.ID) *Traffic {
+	bm.active[p] = time.Now()
+	protos, ok := bm.traffic[p]
+	if !ok {
+		if len(bm.traffic) >= maxTrafficPeers {
+			bm.evictIdlest()
+		}
+		protos = make(map[protocol.ID]*Traffic)
+		bm.traffic[p] = protos
+	}
+	t, ok := protos[proto]
+	if !ok {
+		t = &Traffic{}
+		protos[proto] = t
+	}
+	return t
+}
+
+// returns the limiter of a peer, mtx has to be held
+func (bm *BandwidthMeter) peerLimiter(limiters map[peer.ID]*limiter, p peer.ID) *limiter {
+	l, ok := limiters[p]
+	if !ok {
+		l = newLimiter(bm.peerLimit)
+		limiters[p] = l
+	}
+	return l
+}
+
+// drops the counters of the peer which was idle the longest, mtx has to be
+// held
+func (bm *BandwidthMeter) evictIdlest() {
+	var idlest peer.ID
+	var since time.Time
+	for p := range bm.traffic {
+		if idlest == "" || bm.active[p].Before(since) {
+			idlest, since = p, bm.active[p]
+		}
+	}
+	bm.drop(idlest)
+}
+
+// forgets everything about a peer, mtx has to be held
+func (bm *BandwidthMeter) drop(p peer.ID) {
+	delete(bm.traffic, p)
+	delete(bm.active, p)
+	delete(bm.peerIn, p)
+	delete(bm.peerOut, p)
+}
+
+// drops the limiters of a disconnected peer, its traffic is kept until it
+// ages out (see Prune)
+func (bm *BandwidthMeter) PeerDisconnected(p peer.ID) {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+	delete(bm.peerIn, p)
+	delete(bm.peerOut, p)
+}
+
+// drops the counters of peers without traffic for trafficRetention, the ones
+// of connected peers are kept
+func (bm *BandwidthMeter) Prune(connected func(peer.ID) bool) {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	for p, last := range bm.active {
+		if time.Since(last) > trafficRetention && !connected(p) {
+			bm.drop(p)
+		}
+	}
+
+	// the wrapped reporter keeps its own per peer meters
+	if counter, ok := bm.Reporter.(*metrics.BandwidthCounter); ok {
+		counter.TrimIdle(time.Now().Add(-trafficRetention))
+	}
+}
+
+// returns a copy of the traffic per peer and protocol
+func (bm *BandwidthMeter) Traffic() map[peer.ID]map[protocol.ID]Traffic {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	res := make(map[peer.ID]map[protocol.ID]Traffic, len(bm.traffic))
+	for p, protos := range bm.traffic {
+		res[p] = make(map[protocol.ID]Traffic, len(protos))
+		for proto, t := range protos {
+			res[p][proto] = *t
+		}
+	}
+	return res
+}
+
+// returns the configured limits in bytes per second and direction
+func (bm *BandwidthMeter) Limits() (limit int64, peerLimit int64) {
+	return bm.limit, bm.peerLimit
+}
+
+// a token bucket which holds at most one second of traffic
+type limiter struct {
+	mtx    sync.Mutex
+	rate   float64 // bytes per second, 0 means unlimited
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate int64) *limiter {
+	return &limiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// takes size tokens and sleeps until the bucket is no longer in debt
+func (l *limiter) wait(size int64) {
+	if l.rate <= 0 {
+		return
+	}
+
+	l.mtx.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(size)
+	debt := -l.tokens
+	l.mtx.Unlock()
+
+	if debt > 0 {
+		time.Sleep(time.Duration(debt / l.rate * float64(time.Second)))
+	}
+}
@@ -0,0 +1,151 @@
+package ipfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/multiformats/go-varint"
+)
+
+// the largest section accepted when reading an archive, a block of at most
+// 2 MiB plus its cid
+const maxCARSectionSize = 2<<20 + 128
+
+// header of a CARv1 archive, see https://ipld.io/specs/transport/car/carv1/
+type carHeader struct {
+	Roots   []cid.Cid
+	Version uint64
+}
+
+func init() {
+	cbor.RegisterCborType(carHeader{})
+}
+
+// CARWriter streams blocks into a CARv1 archive
+type CARWriter struct {
+	w io.Writer
+}
+
+// Creates a CARWriter and writes the archive header for the given roots
+func NewCARWriter(w io.Writer, roots []cid.Cid) (*CARWriter, error) {
+	header, err := cbor.DumpObject(&carHeader{Roots: roots, Version: 1})
+	if err != nil {
+		return nil, err
+	}
+
+	cw := &CARWriter{w}
+	if err := cw.writeSection(header); err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+// appends a block to the archive
+func (cw *CARWriter) Put(blk blocks.Block) error {
+	return cw.writeSection(blk.Cid().Bytes(), blk.RawData())
+}
+
+// writes the length prefixed concatenation of the given data
+func (cw *CARWriter) writeSection(data ...[]byte) error {
+	var size uint64
+	for _, d := range data {
+		size += uint64(len(d))
+	}
+
+	if _, err := cw.w.Write(varint.ToUvarint(size)); err != nil {
+		return err
+	}
+	for _, d := range data {
+		if _, err := cw.w.Write(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads a CARv1 archive, calls fn for each contained block and returns the
+// archives roots. CARv2 archives are not supported, they have to be converted
+// to CARv1 first, e.g. with "car get-dag" of go-car.
+func ReadCAR(r io.Reader, fn func(blocks.Block) error) ([]cid.Cid, error) {
+	br := bufio.NewReader(r)
+
+	data, err := readSection(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read car header: %w", err)
+	}
+
+	var header carHeader
+	err = cbor.DecodeInto(data, &header)
+	if err != nil {
+		return nil, err
+	}
+	// CARv2 archives start with a pragma which decodes as a version 2 header
+	if header.Version == 2 {
+		return nil, errors.New("CARv2 archives are not supported, convert the archive to CARv1")
+	}
+	if header.Version != 1 {
+		return nil, fmt.Errorf("unsupported car version %d", header.Version)
+	}
+
+	for {
+		data, err := readSection(br)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		n, c, err := cid.CidFromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+
+		// make sure the data actually belongs to the cid
+		sum, err := c.Prefix().Sum(data[n:])
+		if err != nil {
+			return nil, err
+		}
+		if !sum.Equals(c) {
+			return nil, fmt.Errorf("car block %s does not match its data", c)
+		}
+
+		blk, err := blocks.NewBlockWithCid(data[n:], c)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := fn(blk); err != nil {
+			return nil, err
+		}
+	}
+
+	return header.Roots, nil
+}
+
+// reads one length prefixed section, the size is checked before anything is
+// allocated since it comes from the archive
+func readSection(br *bufio.Reader) ([]byte, error) {
+	size, err := varint.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxCARSectionSize {
+		return nil, fmt.Errorf("car section of %d bytes exceeds %d bytes", size, maxCARSectionSize)
+	}
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(br, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
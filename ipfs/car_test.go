@@ -0,0 +1,96 @@
+package ipfs
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/multiformats/go-varint"
+)
+
+func TestCARRoundTrip(t *testing.T) {
+	blks := []blocks.Block{
+		blocks.NewBlock([]byte("first block")),
+		blocks.NewBlock([]byte("second block")),
+		blocks.NewBlock(bytes.Repeat([]byte{1}, 1<<20)),
+	}
+	roots := []cid.Cid{blks[0].Cid()}
+
+	var buf bytes.Buffer
+	cw, err := NewCARWriter(&buf, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blk := range blks {
+		if err := cw.Put(blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var read []blocks.Block
+	readRoots, err := ReadCAR(&buf, func(blk blocks.Block) error {
+		read = append(read, blk)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(readRoots) != 1 || !readRoots[0].Equals(roots[0]) {
+		t.Fatalf("got roots %v, want %v", readRoots, roots)
+	}
+	if len(read) != len(blks) {
+		t.Fatalf("got %d blocks, want %d", len(read), len(blks))
+	}
+	for i, blk := range read {
+		if !blk.Cid().Equals(blks[i].Cid()) || !bytes.Equal(blk.RawData(), blks[i].RawData()) {
+			t.Fatalf("block %d differs", i)
+		}
+	}
+}
+
+func TestCARRejectsTamperedBlock(t *testing.T) {
+	blk := blocks.NewBlock([]byte("original"))
+
+	var buf bytes.Buffer
+	cw, err := NewCARWriter(&buf, []cid.Cid{blk.Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.writeSection(blk.Cid().Bytes(), []byte("tampered")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ReadCAR(&buf, func(blocks.Block) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected a mismatch error, got %v", err)
+	}
+}
+
+func TestCARRejectsOversizedSection(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(varint.ToUvarint(1 << 62))
+
+	_, err := readSection(bufio.NewReader(&buf))
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("expected a size error, got %v", err)
+	}
+}
+
+func TestCARRejectsV2(t *testing.T) {
+	header, err := cbor.DumpObject(&carHeader{Version: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	(&CARWriter{&buf}).writeSection(header)
+
+	_, err = ReadCAR(&buf, func(blocks.Block) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "CARv2") {
+		t.Fatalf("expected a CARv2 error, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package ipfs
+
+import (
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// a connection gater which only allows what all of its gaters allow
+type chainGater []connmgr.ConnectionGater
+
+func (c chainGater) InterceptPeerDial(p peer.ID) bool {
+	for _, g := range c {
+		if !g.InterceptPeerDial(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c chainGater) InterceptAddrDial(p peer.ID, addr ma.Multiaddr) bool {
+	for _, g := range c {
+		if !g.InterceptAddrDial(p, addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c chainGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	for _, g := range c {
+		if !g.InterceptAccept(addrs) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c chainGater) InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) bool {
+	for _, g := range c {
+		if !g.InterceptSecured(dir, p, addrs) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c chainGater) InterceptUpgraded(conn network.Conn) (bool, control.DisconnectReason) {
+	for _, g := range c {
+		if allow, reason := g.InterceptUpgraded(conn); !allow {
+			return false, reason
+		}
+	}
+	return true, 0
+}
@@ -0,0 +1,50 @@
+package ipfs
+
+import (
+	"fmt"
+
+	kubo_libp2p "github.com/ipfs/kubo/core/node/libp2p"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/metrics"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+)
+
+// builds the libp2p host like kubo does, but with the given connection gater
+// in front of kubo's own address filters and the bandwidth meter wrapping
+// kubo's reporter. libp2p only accepts a single gater and reporter, so the
+// options are applied to the config by hand to chain them. Both may be nil.
+func hostOption(gater connmgr.ConnectionGater, meter *BandwidthMeter) kubo_libp2p.HostOption {
+	return func(id peer.ID, ps peerstore.Peerstore, options ...libp2p.Option) (host.Host, error) {
+		pkey := ps.PrivKey(id)
+		if pkey == nil {
+			return nil, fmt.Errorf("missing private key for node ID: %s", id)
+		}
+		options = append([]libp2p.Option{libp2p.Identity(pkey), libp2p.Peerstore(ps)}, options...)
+		options = append(options, libp2p.FallbackDefaults)
+
+		var cfg libp2p.Config
+		err := cfg.Apply(options...)
+		if err != nil {
+			return nil, err
+		}
+
+		if gater != nil && cfg.ConnectionGater != nil {
+			cfg.ConnectionGater = chainGater{gater, cfg.ConnectionGater}
+		} else if gater != nil {
+			cfg.ConnectionGater = gater
+		}
+
+		if meter != nil {
+			meter.Reporter = cfg.Reporter
+			if meter.Reporter == nil {
+				meter.Reporter = metrics.NewBandwidthCounter()
+			}
+			cfg.Reporter = meter
+		}
+
+		return cfg.NewNode()
+	}
+}
@@ -0,0 +1,169 @@
+package ipfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	peersdbConf "peersdb/config"
+
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// generates a new node identity of the given key type, ed25519 or rsa. The
+// key size only applies to rsa keys.
+func NewIdentity(keyType string, bits int) (config.Identity, error) {
+	opts := []options.KeyGenerateOption{options.Key.Type(keyType)}
+	switch keyType {
+	case options.Ed25519Key:
+	case options.RSAKey:
+		opts = append(opts, options.Key.Size(bits))
+	default:
+		return config.Identity{}, fmt.Errorf("unknown key type %s, try %s or %s",
+			keyType, options.Ed25519Key, options.RSAKey)
+	}
+
+	return config.CreateIdentity(io.Discard, opts)
+}
+
+// the identity a new repo is created with, it is either read from the file
+// given by -identity or generated according to -key-type
+func initialIdentity() (config.Identity, error) {
+	if *peersdbConf.FlagIdentity != "" {
+		return ReadIdentity(*peersdbConf.FlagIdentity)
+	}
+	return NewIdentity(*peersdbConf.FlagKeyType, *peersdbConf.FlagKeyBits)
+}
+
+// reads an exported identity and checks that the key belongs to the peer id
+func ReadIdentity(path string) (config.Identity, error) {
+	var id config.Identity
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return id, err
+	}
+	err = json.Unmarshal(data, &id)
+	if err != nil {
+		return id, err
+	}
+
+	key, err := id.DecodePrivateKey("")
+	if err != nil {
+		return id, err
+	}
+	peerID, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return id, err
+	}
+	if peerID.String() != id.PeerID {
+		return id, errors.New("the private key does not belong to peer " + id.PeerID)
+	}
+
+	return id, nil
+}
+
+// writes the identity of the node to the given file, it contains the private
+// key so only the owner may read it
+func ExportIdentity(node *core.IpfsNode, path string) error {
+	cfg, err := node.Repo.Config()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg.Identity, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// the file identities are kept in after they were replaced, their keys are
+// needed to decrypt what was encrypted for them
+func retiredIdentitiesPath() string {
+	return *peersdbConf.FlagRepo + "_retired_identities"
+}
+
+// returns the private keys of the replaced identities by peer id
+func RetiredKeys() (map[string]crypto.PrivKey, error) {
+	ids, err := retiredIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PrivKey, len(ids))
+	for _, id := range ids {
+		key, err := id.DecodePrivateKey("")
+		if err != nil {
+			return nil, err
+		}
+		keys[id.PeerID] = key
+	}
+	return keys, nil
+}
+
+func retiredIdentities() ([]config.Identity, error) {
+	data, err := ioutil.ReadFile(retiredIdentitiesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ids []config.Identity
+	err = json.Unmarshal(data, &ids)
+	return ids, err
+}
+
+// keeps a replaced identity, the file holds private keys so only the owner may
+// read it
+func retireIdentity(id config.Identity) error {
+	ids, err := retiredIdentities()
+	if err != nil {
+		return err
+	}
+	for _, r := range ids {
+		if r.PeerID == id.PeerID {
+			return nil
+		}
+	}
+	ids = append(ids, id)
+
+	data, err := json.MarshalIndent(ids, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(retiredIdentitiesPath(), data, 0600)
+}
+
+// replaces the identity stored in the repo, the node keeps its current
+// identity until it is restarted. The current identity is retired, so its key
+// remains available for decryption.
+func SetIdentity(node *core.IpfsNode, id config.Identity) error {
+	cfg, err := node.Repo.Config()
+	if err != nil {
+		return err
+	}
+
+	if cfg.Identity.PeerID != id.PeerID {
+		err = retireIdentity(cfg.Identity)
+		if err != nil {
+			return err
+		}
+	}
+
+	newCfg, err := cfg.Clone()
+	if err != nil {
+		return err
+	}
+	newCfg.Identity = id
+
+	return node.Repo.SetConfig(newCfg)
+}
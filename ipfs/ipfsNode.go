@@ -2,8 +2,8 @@ package ipfs
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -15,6 +15,9 @@ import (
 	kubo_libp2p "github.com/ipfs/kubo/core/node/libp2p"
 	"github.com/ipfs/kubo/plugin/loader" // This package is needed so that all the preloaded plugins are loaded automatically
 	"github.com/ipfs/kubo/repo/fsrepo"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
 )
 
 // Setup ipfs plugins
@@ -51,7 +54,7 @@ func exists(path string) (bool, error) {
 
 // Creates a temporary ipfs repo, from the docs :
 // "ipfs stores all its settings and internal data in a directory called the repository"
-// removal has to be taken care of by caller
+// removal has to be taken care of by caller. An existing repo is used as is.
 func createRepo(temporary bool) (string, error) {
 	repoPath := "./" + *peersdbConf.FlagRepo
 
@@ -67,8 +70,21 @@ func createRepo(temporary bool) (string, error) {
 		return "", fmt.Errorf("failed to get dir: %s", err)
 	}
 
-	// Create a config with default options and a 2048 bit key
-	cfg, err := config.Init(io.Discard, 2048)
+	// an existing repo keeps its identity, -identity and -key-type only apply
+	// to new ones
+	if fsrepo.IsInitialized(repoPath) {
+		if *peersdbConf.FlagIdentity != "" {
+			log.Printf("The repo %s exists already, ignoring -identity\n", repoPath)
+		}
+		return repoPath, nil
+	}
+
+	// Create a config with default options and the configured identity
+	identity, err := initialIdentity()
+	if err != nil {
+		return "", err
+	}
+	cfg, err := config.InitWithIdentity(identity)
 	if err != nil {
 		return "", err
 	}
@@ -89,7 +105,6 @@ func createRepo(temporary bool) (string, error) {
 	cfg.Pubsub = pubsubCfg
 
 	// Start without peers
-	// TODO : should private/public network be controlled by config ?
 	cfg.Bootstrap = []string{}
 
 	// There seems to be a problem with pubsub under MDNS ,which leads to
@@ -97,9 +112,21 @@ func createRepo(temporary bool) (string, error) {
 	// https://github.com/ipfs/kubo/issues/7757
 	cfg.Discovery.MDNS.Enabled = false
 
-	// TODO : configurable host id
-	// cfg.Identity =
+	configure(cfg)
+
+	// Create the repo with the config
+	err = fsrepo.Init(repoPath, cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to init ephemeral node: %+v", err)
+	}
+	log.Printf("Path of the IPFS repository : %s\n", repoPath)
+
+	return repoPath, nil
+}
 
+// Applies all settings which depend on flags. This is done on every start, so
+// changed flags also take effect for existing repos.
+func configure(cfg *config.Config) {
 	// experimental features
 	if *peersdbConf.FlagExp {
 		// https://github.com/ipfs/kubo/blob/master/docs/experimental-features.md#ipfs-filestore
@@ -114,49 +141,144 @@ func createRepo(temporary bool) (string, error) {
 		// And: https://github.com/ipfs/kubo/blob/master/docs/experimental-features.md
 	}
 
-	// Configure swarm addresses/where to listen
-	// TODO : make ip configurable
-	cfg.Addresses.Swarm = []string{
-		"/ip4/0.0.0.0/tcp/" + *peersdbConf.FlagIPFSPort,
-		"/ip6/::1/tcp/" + *peersdbConf.FlagIPFSPort,
+	// Configure swarm addresses/where to listen and what to tell other peers
+	cfg.Addresses.Swarm = listenAddrs()
+	cfg.Addresses.Announce = splitAddrs(*peersdbConf.FlagAnnounce)
+	cfg.Addresses.NoAnnounce = splitAddrs(*peersdbConf.FlagNoAnnounce)
+
+	// transports
+	cfg.Swarm.Transports.Network.QUIC = configFlag(*peersdbConf.FlagQUIC)
+	cfg.Swarm.Transports.Network.Websocket = configFlag(*peersdbConf.FlagWebsocket)
+
+	// connection manager, 0 keeps the kubo default
+	if *peersdbConf.FlagConnLow > 0 {
+		cfg.Swarm.ConnMgr.LowWater = config.NewOptionalInteger(int64(*peersdbConf.FlagConnLow))
+	}
+	if *peersdbConf.FlagConnHigh > 0 {
+		cfg.Swarm.ConnMgr.HighWater = config.NewOptionalInteger(int64(*peersdbConf.FlagConnHigh))
+	}
+	if *peersdbConf.FlagConnGrace > 0 {
+		cfg.Swarm.ConnMgr.GracePeriod = config.NewOptionalDuration(*peersdbConf.FlagConnGrace)
 	}
 
-	// Create the repo with the config
-	err = fsrepo.Init(repoPath, cfg)
+	// resource manager
+	cfg.Swarm.ResourceMgr.Enabled = configFlag(*peersdbConf.FlagResourceMgr)
+	if *peersdbConf.FlagMaxMemory != "" {
+		cfg.Swarm.ResourceMgr.MaxMemory = config.NewOptionalString(*peersdbConf.FlagMaxMemory)
+	}
+	if *peersdbConf.FlagMaxFDs > 0 {
+		cfg.Swarm.ResourceMgr.MaxFileDescriptors = config.NewOptionalInteger(int64(*peersdbConf.FlagMaxFDs))
+	}
+
+	// NAT traversal
+	if *peersdbConf.FlagAutoNAT {
+		cfg.AutoNAT.ServiceMode = config.AutoNATServiceEnabled
+	} else {
+		cfg.AutoNAT.ServiceMode = config.AutoNATServiceDisabled
+	}
+	cfg.Swarm.EnableHolePunching = configFlag(*peersdbConf.FlagHolePunching)
+	cfg.Swarm.DisableNatPortMap = !*peersdbConf.FlagNATPortMap
+	cfg.Swarm.RelayClient.Enabled = configFlag(*peersdbConf.FlagRelayClient)
+	cfg.Swarm.RelayClient.StaticRelays = splitAddrs(*peersdbConf.FlagStaticRelays)
+	cfg.Swarm.RelayService.Enabled = configFlag(*peersdbConf.FlagRelayService)
+
+	// both sides of circuit relay need the relay transport
+	if *peersdbConf.FlagRelayClient || *peersdbConf.FlagRelayService {
+		cfg.Swarm.Transports.Network.Relay = config.True
+	}
+
+	// private networks only allow peers with the same pre-shared key, so the
+	// transports which do not support it have to be disabled
+	if *peersdbConf.FlagPrivate {
+		cfg.Swarm.Transports.Network.QUIC = config.False
+		cfg.Swarm.Transports.Network.WebTransport = config.False
+
+		// never bootstrap from the public network
+		cfg.Bootstrap = []string{}
+	}
+}
+
+// the file kubo loads the limits of single resource manager scopes from
+const limitsFile = "libp2p-resource-limit-overrides.json"
+
+// copies the configured resource manager limits into the repo, where kubo
+// expects them
+func importLimits(repoPath string) error {
+	data, err := os.ReadFile(*peersdbConf.FlagLimits)
 	if err != nil {
-		return "", fmt.Errorf("failed to init ephemeral node: %+v", err)
+		return err
 	}
-	log.Printf("Path of the IPFS repository : %s\n", repoPath)
 
-	return repoPath, nil
+	// refuse to start with broken limits
+	var limits rcmgr.PartialLimitConfig
+	err = json.Unmarshal(data, &limits)
+	if err != nil {
+		return fmt.Errorf("invalid resource manager limits: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(repoPath, limitsFile), data, 0644)
 }
 
 // Creates an IPFS node and returns its coreAPI
-func createNode(ctx context.Context, repoPath string) (*core.IpfsNode, error) {
+func createNode(ctx context.Context, repoPath string, gater connmgr.ConnectionGater,
+	meter *BandwidthMeter, scoredTopics func(self string) []string) (*core.IpfsNode, error) {
 	// Open the repo
 	repo, err := fsrepo.Open(repoPath)
 	if err != nil {
 		return nil, err
 	}
 
+	// apply the flag dependent settings
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err = cfg.Clone()
+	if err != nil {
+		return nil, err
+	}
+	configure(cfg)
+	err = repo.SetConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// Construct the node
 	nodeOptions := &core.BuildCfg{
 		Online:  true,
 		Routing: kubo_libp2p.DHTOption, // This option sets the node to be a full DHT node (both fetching and storing DHT Records)
 		// Routing: libp2p.DHTClientOption, // This option sets the node to be a client DHT node (only fetching records)
 		Repo: repo,
+		// pubsub is a must for orbitdb, but kubo doesn't allow to enable peer
+		// scoring, so the router is created below
 		ExtraOpts: map[string]bool{
-			"pubsub": true, // must for orbitdb
+			"pubsub": false,
 		},
 		Permanent: true, // improve performance for long runs TODO : make this configurable for benchmarking
 	}
+	if gater != nil || meter != nil {
+		nodeOptions.Host = hostOption(gater, meter)
+	}
+
+	node, err := core.NewNode(ctx, nodeOptions)
+	if err != nil {
+		return nil, err
+	}
 
-	return core.NewNode(ctx, nodeOptions)
+	node.PubSub, err = newGossipSub(ctx, node, scoredTopics(node.Identity.String()))
+	if err != nil {
+		node.Close()
+		return nil, err
+	}
+	return node, nil
 }
 
 // Spawns a node to be used just for this run (i.e. creates a tmp repo)
-// removal of repo has to be taken care of by caller
-func SpawnEphemeral(ctx context.Context) (*core.IpfsNode, error) {
+// removal of repo has to be taken care of by caller. The gater and the meter
+// may be nil. Invalid messages on the pubsub topics returned by scoredTopics
+// for the node's peer id lower the sender's peer score.
+func SpawnEphemeral(ctx context.Context, gater connmgr.ConnectionGater,
+	meter *BandwidthMeter, scoredTopics func(self string) []string) (*core.IpfsNode, error) {
 
 	// TODO : why does this have to be run as sync once ?
 	var err error
@@ -167,16 +289,37 @@ func SpawnEphemeral(ctx context.Context) (*core.IpfsNode, error) {
 		return nil, err
 	}
 
-	// Create a Temporary IPFS Repo
-	repoPath, err := createRepo(false)
+	// Create the IPFS Repo, it's persistent and holds the identity of the node
+	temporary := false
+	repoPath, err := createRepo(temporary)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create actual ipfs ndoe based on temporary repo
-	node, err := createNode(ctx, repoPath)
+	// only allow peers with our pre-shared key
+	if *peersdbConf.FlagPrivate {
+		err = ensureSwarmKey(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		pnet.ForcePrivateNetwork = true
+	}
+
+	// limits of single resource manager scopes are read from a file in the repo
+	if *peersdbConf.FlagLimits != "" {
+		err = importLimits(repoPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Create actual ipfs ndoe based on the repo, only a temporary one is
+	// removed if that fails
+	node, err := createNode(ctx, repoPath, gater, meter, scoredTopics)
 	if err != nil {
-		os.RemoveAll(repoPath)
+		if temporary {
+			os.RemoveAll(repoPath)
+		}
 		return nil, err
 	}
 	log.Printf("node ident string :%s\n", node.Identity.String())
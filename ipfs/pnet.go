@@ -0,0 +1,69 @@
+package ipfs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+
+	peersdbConf "peersdb/config"
+
+	"github.com/libp2p/go-libp2p/core/pnet"
+)
+
+// the file kubo loads the pre-shared key of a private network from
+const swarmKeyFile = "swarm.key"
+
+// Creates a new pre-shared key in the format kubo expects in the swarm.key file
+func GenerateSwarmKey() ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte("/key/swarm/psk/1.0.0/\n/base16/\n" + hex.EncodeToString(key) + "\n"), nil
+}
+
+// makes sure the repo holds a valid swarm key. If a key file has been
+// configured it's copied into the repo, if there is no key at all a new one is
+// generated, which has to be copied to all other peers of the network.
+func ensureSwarmKey(repoPath string) error {
+	keyPath := filepath.Join(repoPath, swarmKeyFile)
+
+	var key []byte
+	var err error
+	switch {
+	case *peersdbConf.FlagSwarmKey != "":
+		key, err = ioutil.ReadFile(*peersdbConf.FlagSwarmKey)
+		if err != nil {
+			return err
+		}
+
+	default:
+		if exists, _ := exists(keyPath); exists {
+			key, err = ioutil.ReadFile(keyPath)
+			if err != nil {
+				return err
+			}
+			break
+		}
+
+		key, err = GenerateSwarmKey()
+		if err != nil {
+			return err
+		}
+		log.Printf("Generated a new swarm key, share %s with all peers of the private network\n", keyPath)
+	}
+
+	// refuse to start with a broken key
+	_, err = pnet.DecodeV1PSK(bytes.NewReader(key))
+	if err != nil {
+		return fmt.Errorf("invalid swarm key: %w", err)
+	}
+
+	return ioutil.WriteFile(keyPath, key, 0600)
+}
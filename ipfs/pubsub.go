@@ -0,0 +1,74 @@
+package ipfs
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/ipfs/kubo/core"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p-pubsub/timecache"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/backoff"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+)
+
+// the score a peer loses per invalid message on a scored topic, the counter is
+// squared, so a few malformed messages are tolerated while a flood quickly
+// drops the peer below the thresholds
+const (
+	invalidMessageWeight = -10
+	invalidMessageDecay  = time.Hour
+)
+
+// below the gossip threshold gossip of a peer is ignored, below the publish
+// threshold we don't publish to it and below the graylist threshold all of its
+// messages are ignored
+var scoreThresholds = &pubsub.PeerScoreThresholds{
+	GossipThreshold:   -100,
+	PublishThreshold:  -500,
+	GraylistThreshold: -1000,
+}
+
+// Creates the gossipsub router of the node. It's configured like kubo's, but
+// with peer scoring enabled, invalid messages on the given topics lower the
+// score of the peer which delivered them.
+func newGossipSub(ctx context.Context, node *core.IpfsNode, scoredTopics []string) (*pubsub.PubSub, error) {
+	topics := make(map[string]*pubsub.TopicScoreParams, len(scoredTopics))
+	for _, t := range scoredTopics {
+		topics[t] = &pubsub.TopicScoreParams{
+			TopicWeight:                    1,
+			TimeInMeshQuantum:              time.Second,
+			InvalidMessageDeliveriesWeight: invalidMessageWeight,
+			InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(invalidMessageDecay),
+		}
+	}
+	scoreParams := &pubsub.PeerScoreParams{
+		Topics:           topics,
+		AppSpecificScore: func(peer.ID) float64 { return 0 },
+		DecayInterval:    pubsub.DefaultDecayInterval,
+		DecayToZero:      pubsub.DefaultDecayToZero,
+		// scores survive reconnects for as long as the penalties decay
+		RetainScore: invalidMessageDecay,
+	}
+
+	// the topic discovery of kubo, which is not available once we build the
+	// router ourselves
+	rng := rand.New(rand.NewSource(rand.Int63()))
+	disc, err := backoff.NewBackoffDiscovery(
+		drouting.NewRoutingDiscovery(node.Routing),
+		backoff.NewExponentialBackoff(time.Minute, time.Hour, backoff.FullJitter,
+			time.Second, 5.0, 0, rng),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pubsub.NewGossipSub(ctx, node.PeerHost,
+		pubsub.WithMessageSigning(true),
+		pubsub.WithSeenMessagesStrategy(timecache.Strategy_LastSeen),
+		pubsub.WithDiscovery(disc),
+		pubsub.WithFloodPublish(true),
+		pubsub.WithPeerScore(scoreParams, scoreThresholds),
+	)
+}